@@ -0,0 +1,90 @@
+package element
+
+import "sync/atomic"
+
+// batch collects the changes of elements during the write lock of Manager held.
+// The shards touched are locked until the batch ends, and the count, View and joined flags of elements
+// are updated at once when the batch ends, so readers without the Manager's lock could not see the partial changes.
+type batch struct {
+	locked  map[*shard]bool
+	touched map[uint64]touched
+	delta   int64
+	cleared bool
+	changes []Change
+}
+
+type touched struct {
+	e  ELEMENT
+	in bool
+}
+
+// lock acquires the write lock of Manager and begins a batch.
+func (m *Manager) lock() {
+	m.rw.Lock()
+	m.batch = &batch{
+		locked:  make(map[*shard]bool),
+		touched: make(map[uint64]touched),
+	}
+}
+
+// unlock ends the batch, publishes the changes and then releases the write lock of Manager.
+// The referrers of ELEMENTS left are handled by the actions of relations after the lock released.
+func (m *Manager) unlock() {
+	b := m.batch
+	m.batch = nil
+	atomic.AddInt64(&m.count, b.delta)
+	if m.cow && (b.cleared || len(b.touched) != 0) {
+		current := m.view.Load().(*View)
+		if b.cleared {
+			current = emptyView
+		}
+		elements := make(map[uint64]ELEMENT, len(current.elements)+len(b.touched))
+		for k, v := range current.elements {
+			elements[k] = v
+		}
+		for id, t := range b.touched {
+			if t.in {
+				elements[id] = t.e
+			} else {
+				delete(elements, id)
+			}
+		}
+		m.view.Store(&View{
+			elements: elements,
+		})
+	}
+	var left []*Element
+	for _, t := range b.touched {
+		if t.in {
+			atomic.StoreUint32(&t.e.Meta().in, 1)
+		} else {
+			atomic.StoreUint32(&t.e.Meta().in, 0)
+			left = append(left, t.e.Meta())
+		}
+	}
+	for s := range b.locked {
+		s.rw.Unlock()
+	}
+	m.publish(b.changes)
+	referenced := m.referenced
+	m.rw.Unlock()
+	if len(left) != 0 && len(referenced) != 0 {
+		dereference(referenced, left)
+	}
+}
+
+// lockShard locks the shard until the batch ends, it returns the shard.
+func (b *batch) lockShard(s *shard) *shard {
+	if !b.locked[s] {
+		s.rw.Lock()
+		b.locked[s] = true
+	}
+	return s
+}
+
+func (b *batch) record(op ChangeOp, e ELEMENT) {
+	b.changes = append(b.changes, Change{
+		Op:      op,
+		Element: e,
+	})
+}
@@ -0,0 +1,104 @@
+package element
+
+import "sync/atomic"
+
+// WithComputedIndex defines an index field which values are computed by the function f of ELEMENT,
+// such as lowercase hostname or time bucket derived from the payload of ELEMENT.
+// The function is evaluated when the ELEMENT joins the Manager, and when Refresh or RefreshAll called after the payload changed.
+// It returns multiple values for multi-valued index, the field is deleted from the ELEMENT when no values returned.
+// The values computed replace the values of the field set by Element.SetIndex.
+// The function is called with the Manager's write lock held, so it must not call methods of Manager.
+func WithComputedIndex(field string, f func(ELEMENT) []interface{}) Option {
+	return func(m *Manager) {
+		m.computed[field] = f
+	}
+}
+
+// Refresh evaluates the computed indexes for the Element in Manager, and updates the index values which are changed.
+// The version of the Element is increased when any value changed.
+// It returns ErrNotJoined when the Element is not in the Manager, or ErrKeyConflict when the new values conflict with any unique constraint.
+func (m *Manager) Refresh(e *Element) error {
+	tx := m.Begin()
+	tx.Refresh(e)
+	return tx.Commit()
+}
+
+// RefreshAll evaluates the computed indexes for all ELEMENTS in Manager atomically,
+// no index will be updated when any of them fails.
+func (m *Manager) RefreshAll() error {
+	tx := m.Begin()
+	tx.ops = append(tx.ops, func(c *txCommit) error {
+		for _, s := range m.shards {
+			for _, e := range s.elements {
+				if err := m.refresh(c, e.Meta()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+	return tx.Commit()
+}
+
+// compute evaluates the computed indexes of the ELEMENT and replace the values of its indexes when changed.
+// It's called before the ELEMENT joins, the caller must hold the write lock of Manager.
+func (m *Manager) compute(e ELEMENT) {
+	meta := e.Meta()
+	indexes, changed := m.computeIndexes(e)
+	if changed {
+		meta.indexes = indexes
+		atomic.AddUint64(&meta.version, 1)
+	}
+}
+
+// refresh updates the computed indexes of the Element in Manager, the caller must hold the write lock of Manager.
+func (m *Manager) refresh(c *txCommit, e *Element) error {
+	ee, ok := m.element(e.id)
+	if !ok {
+		return m.errNotJoined(e)
+	}
+	indexes, changed := m.computeIndexes(ee)
+	if !changed {
+		return nil
+	}
+	return m.replace(c, e, e.keys, indexes)
+}
+
+// computeIndexes returns a copy of indexes of the ELEMENT with the computed values, and whether any value changed.
+func (m *Manager) computeIndexes(e ELEMENT) (map[string][]interface{}, bool) {
+	if len(m.computed) == 0 {
+		return nil, false
+	}
+	meta := e.Meta()
+	indexes := meta.indexes
+	var changed bool
+	for field, f := range m.computed {
+		values := f(e)
+		if equalValues(indexes[field], values) {
+			continue
+		}
+		if !changed {
+			changed = true
+			indexes = replaceField(indexes, field, values)
+			continue
+		}
+		if len(values) == 0 {
+			delete(indexes, field)
+		} else {
+			indexes[field] = append([]interface{}(nil), values...)
+		}
+	}
+	return indexes, changed
+}
+
+func equalValues(a []interface{}, b []interface{}) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,109 @@
+package element
+
+import (
+	"github.com/more-infra/base"
+	"strings"
+	"testing"
+)
+
+const (
+	indexLowerHost = "item.index.lower_host"
+	indexBucket    = "item.index.bucket"
+)
+
+func TestComputedIndex(t *testing.T) {
+	hosts := make(map[*item]string)
+	mgr := NewManager(
+		WithComputedIndex(indexLowerHost, func(e ELEMENT) []interface{} {
+			host, ok := hosts[e.(*item)]
+			if !ok {
+				return nil
+			}
+			// the host and its parent domain
+			host = strings.ToLower(host)
+			values := []interface{}{host}
+			if n := strings.Index(host, "."); n != -1 {
+				values = append(values, host[n+1:])
+			}
+			return values
+		}),
+		WithComputedIndex(indexBucket, func(e ELEMENT) []interface{} {
+			return []interface{}{e.(*item).value / 10}
+		}),
+		WithUniqueConstraint(constraintTenantName, indexTenant, indexBucket),
+	)
+	newHostItem := func(value int, host string) *item {
+		itm := newKeyItem(mgr, value)
+		itm.SetIndex(indexTenant, "t1")
+		hosts[itm] = host
+		return itm
+	}
+	itm1 := newHostItem(1, "Web.Example.COM")
+	itm2 := newHostItem(12, "db.example.com")
+	mgr.Join(itm1)
+	tx := mgr.Begin()
+	tx.Join(itm2)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if ee := mgr.Search(indexLowerHost, "web.example.com"); len(ee) != 1 || ee[0] != itm1 {
+		t.Fatalf("Search by computed index returns unexpected result: %v", ee)
+	}
+	if len(mgr.Search(indexLowerHost, "example.com")) != 2 || len(mgr.Search(indexBucket, 1)) != 1 {
+		t.Fatal("multiple values of computed index are not expected")
+	}
+	if mgr.FindComposite(constraintTenantName, "t1", 1) != itm2 {
+		t.Fatal("unique constraint of computed index is not expected")
+	}
+
+	// the index is not changed until refreshed
+	version := itm1.Version()
+	hosts[itm1] = "cache"
+	itm1.value = 25
+	if len(mgr.Search(indexLowerHost, "cache")) != 0 {
+		t.Fatal("computed index is changed before refreshed")
+	}
+	if err := mgr.Refresh(itm1.Element); err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if len(mgr.Search(indexLowerHost, "cache")) != 1 || len(mgr.Search(indexLowerHost, "example.com")) != 1 ||
+		len(mgr.Search(indexBucket, 2)) != 1 || itm1.Version() != version+1 {
+		t.Fatal("computed index is not refreshed")
+	}
+	// nothing changed
+	if err := mgr.Refresh(itm1.Element); err != nil || itm1.Version() != version+1 {
+		t.Fatalf("Refresh without changes increases version: %v", err)
+	}
+
+	// bucket conflicts with item 1, nothing is refreshed
+	delete(hosts, itm1)
+	hosts[itm2] = "queue"
+	itm2.value = 27
+	if err := mgr.RefreshAll(); base.ErrorType(err) != ErrTypeKeyConflict {
+		t.Fatalf("RefreshAll returns unexpected error: %v", err)
+	}
+	if len(mgr.Search(indexLowerHost, "queue")) != 0 || len(mgr.Search(indexLowerHost, "cache")) != 1 {
+		t.Fatal("RefreshAll is not rolled back")
+	}
+	itm2.value = 33
+	if err := mgr.RefreshAll(); err != nil {
+		t.Fatalf("RefreshAll failed: %v", err)
+	}
+	if len(mgr.Search(indexLowerHost, "cache")) != 0 || len(mgr.Search(indexBucket, 3)) != 1 {
+		t.Fatal("RefreshAll does not refresh all items")
+	}
+	mgr.Remove(itm1.Element)
+	if err := mgr.Refresh(itm1.Element); base.ErrorType(err) != ErrTypeNotJoined {
+		t.Fatalf("Refresh returns unexpected error: %v", err)
+	}
+
+	// bucket conflicts with item 2, the computed indexes and version are restored
+	itm3 := newHostItem(35, "mq")
+	version = itm3.Version()
+	if _, err := mgr.JoinOrError(itm3); base.ErrorType(err) != ErrTypeKeyConflict {
+		t.Fatalf("JoinOrError returns unexpected error: %v", err)
+	}
+	if itm3.Version() != version || len(itm3.indexes) != 1 || len(itm3.indexes[indexLowerHost]) != 0 {
+		t.Fatalf("item version[%d] indexes%v are changed after join failed", itm3.Version(), itm3.indexes)
+	}
+}
@@ -0,0 +1,102 @@
+package element
+
+// constraint is a unique constraint across multiple index fields.
+type constraint struct {
+	fields []string
+	values map[interface{}]uint64
+}
+
+// compositeValue combines values of multiple fields to one comparable value, it's a linked list of values.
+type compositeValue struct {
+	value interface{}
+	next  interface{}
+}
+
+func newCompositeValue(values []interface{}) compositeValue {
+	var next interface{}
+	for n := len(values) - 1; n >= 0; n-- {
+		next = compositeValue{value: values[n], next: next}
+	}
+	return next.(compositeValue)
+}
+
+func (cv compositeValue) values() []interface{} {
+	var values []interface{}
+	var next interface{} = cv
+	for next != nil {
+		v := next.(compositeValue)
+		values = append(values, v.value)
+		next = v.next
+	}
+	return values
+}
+
+// WithUniqueConstraint defines a unique constraint named name across multiple index fields,
+// which means no two ELEMENTS could have the same values of all the fields, but each field could be duplicated.
+// The fields are index fields set by Element.SetIndex, when a field has multiple values, each combination of values is unique.
+// The constraint is ignored for the ELEMENT which does not have all the fields.
+// Use FindComposite to query the ELEMENT by values of the constraint.
+func WithUniqueConstraint(name string, fields ...string) Option {
+	if len(fields) == 0 {
+		panic("element manager unique constraint requires at least one field")
+	}
+	return func(m *Manager) {
+		m.constraints[name] = &constraint{
+			fields: fields,
+			values: make(map[interface{}]uint64),
+		}
+	}
+}
+
+// FindComposite query the ELEMENT by the unique constraint defined by WithUniqueConstraint.
+// The values are in the order of fields of the constraint, it returns nil when not found.
+func (m *Manager) FindComposite(name string, values ...interface{}) ELEMENT {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	c, ok := m.constraints[name]
+	if !ok || len(values) != len(c.fields) {
+		return nil
+	}
+	id, ok := c.values[newCompositeValue(values)]
+	if !ok {
+		return nil
+	}
+	e, _ := m.element(id)
+	m.eviction.touch(id)
+	return e
+}
+
+// composites returns the composite values of each unique constraint for the Element.
+// The caller must hold the lock of Manager.
+func (m *Manager) composites(meta *Element) map[string][]interface{} {
+	var composites map[string][]interface{}
+	for name, c := range m.constraints {
+		combinations := [][]interface{}{nil}
+		for _, f := range c.fields {
+			vv := meta.indexes[f]
+			if len(vv) == 0 {
+				combinations = nil
+				break
+			}
+			var next [][]interface{}
+			for _, combination := range combinations {
+				for _, v := range vv {
+					values := make([]interface{}, len(combination), len(combination)+1)
+					copy(values, combination)
+					next = append(next, append(values, v))
+				}
+			}
+			combinations = next
+		}
+		if len(combinations) == 0 {
+			continue
+		}
+		if composites == nil {
+			composites = make(map[string][]interface{})
+		}
+		for _, values := range combinations {
+			composites[name] = append(composites[name], newCompositeValue(values))
+		}
+	}
+	return composites
+}
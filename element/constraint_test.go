@@ -0,0 +1,92 @@
+package element
+
+import (
+	"github.com/more-infra/base"
+	"testing"
+)
+
+const (
+	indexTenant          = "item.index.tenant"
+	indexName            = "item.index.name"
+	constraintTenantName = "item.unique.tenant_name"
+)
+
+func TestUniqueConstraint(t *testing.T) {
+	mgr := NewManager(WithUniqueConstraint(constraintTenantName, indexTenant, indexName))
+	newTenantItem := func(value int, tenant string, names ...string) *item {
+		itm := newKeyItem(mgr, value)
+		itm.SetIndex(indexTenant, tenant)
+		for _, name := range names {
+			itm.SetIndex(indexName, name)
+		}
+		return itm
+	}
+	items := []*item{
+		newTenantItem(1, "t1", "web"),
+		newTenantItem(2, "t2", "web"),
+		newTenantItem(3, "t1", "db", "cache"),
+		// without name, the constraint is ignored
+		newTenantItem(4, "t1"),
+	}
+	for _, itm := range items {
+		if e, err := mgr.JoinOrError(itm); err != nil || e != itm {
+			t.Fatalf("item[%d] join failed: %v", itm.value, err)
+		}
+	}
+	if e := mgr.FindComposite(constraintTenantName, "t1", "cache"); e != items[2] {
+		t.Fatalf("FindComposite returns[%v] is not expected item[%d]", e, items[2].value)
+	}
+	if mgr.FindComposite(constraintTenantName, "t2", "db") != nil {
+		t.Fatal("FindComposite returns item which is not exists")
+	}
+
+	// conflicts with item 3 by the second name
+	itm := newTenantItem(5, "t1", "queue", "cache")
+	e, err := mgr.JoinOrError(itm)
+	if e != items[2] {
+		t.Fatalf("JoinOrError does not return the exists item[%d]", items[2].value)
+	}
+	if base.ErrorType(err) != ErrTypeKeyConflict || base.OriginalError(err) != ErrKeyConflict {
+		t.Fatalf("JoinOrError returns unexpected error: %v", err)
+	}
+	fields := err.(*base.Error).Fields
+	if fields["field"] != constraintTenantName || fields["existing_id"] != "3" {
+		t.Fatalf("conflict error fields%v are not expected", fields)
+	}
+	// nothing of the conflict item is left
+	if mgr.Find(keySeq, "5") != nil || mgr.FindComposite(constraintTenantName, "t1", "queue") != nil {
+		t.Fatal("keys of conflict item are left in Manager")
+	}
+	if len(mgr.Search(indexName, "queue")) != 0 {
+		t.Fatal("indexes of conflict item are left in Manager")
+	}
+
+	items[2].Leave()
+	if e, err := mgr.JoinOrError(itm); err != nil || e != itm {
+		t.Fatalf("item[%d] join failed after conflict item leaves: %v", itm.value, err)
+	}
+}
+
+func TestJoinOrErrorKeyConflict(t *testing.T) {
+	mgr := NewManager(WithCapacity(2))
+	first := newKeyItem(mgr, 1)
+	first.SetKey(keyUniqueValue, "a")
+	mgr.Join(first)
+
+	// the second key conflicts, the first key must not be left
+	itm := newKeyItem(mgr, 2)
+	itm.SetKey(keyUniqueValue, "a")
+	e, err := mgr.JoinOrError(itm)
+	if e != first || base.ErrorType(err) != ErrTypeKeyConflict {
+		t.Fatalf("JoinOrError returns unexpected result: %v", err)
+	}
+	if mgr.Find(keySeq, "2") != nil {
+		t.Fatal("key of conflict item is left in Manager")
+	}
+
+	mgr.Join(newKeyItem(mgr, 3))
+	e, err = mgr.JoinOrError(newKeyItem(mgr, 4))
+	if e != nil || base.ErrorType(err) != ErrTypeCapacityFull {
+		t.Fatalf("JoinOrError returns unexpected result when Manager is full: %v", err)
+	}
+}
@@ -2,7 +2,6 @@ package element
 
 import (
 	"context"
-	"errors"
 	"sync/atomic"
 )
 
@@ -70,14 +69,29 @@ type Element struct {
 	// mgr is the reference of the Manager which this Element is in.
 	mgr *Manager
 
+	// version is increased by one when the keys or indexes of the Element changed, or it's swapped by Manager.CompareAndSwap.
+	version uint64
+
+	// weight is the weight of the Element calculated by Manager's weigher when it joined.
+	weight int64
+
 	// initial controls the initialization operation of the Element, it's not required.
 	initial *Initialization
 
+	// final is the cleanup function called when the Element leaves the Manager, it's not required.
+	final func()
+
 	// keys defines all keys of the Element.
 	keys map[string][]interface{}
 
 	// indexes defines all indexes of the Element.
 	indexes map[string][]interface{}
+
+	// references are the ELEMENTS referenced by relations defined by WithRelation.
+	references map[string]*Element
+
+	// composites saves the composite values of unique constraints when the Element joined the Manager.
+	composites map[string][]interface{}
 }
 
 type SearchIndexRelation string
@@ -103,25 +117,44 @@ func (e *Element) Leave() {
 	e.mgr.Remove(e)
 }
 
+// LeaveOrError is equal to Manager.RemoveOrError() method, it returns error when the Element is referenced
+// by a relation with RelationRestrict.
+func (e *Element) LeaveOrError() error {
+	return e.mgr.RemoveOrError(e)
+}
+
 // SetKey will set a unique key for the Element. the value type must be types thar supports "==" operation.
 func (e *Element) SetKey(field string, value interface{}) {
 	e.keys[field] = append(e.keys[field], value)
+	atomic.AddUint64(&e.version, 1)
 }
 
 // SetIndex will set an index for the Element. the value type must be types thar supports "==" operation.
 func (e *Element) SetIndex(field string, value interface{}) {
 	e.indexes[field] = append(e.indexes[field], value)
+	atomic.AddUint64(&e.version, 1)
+}
+
+// Version returns the version of the Element, it's increased by one on every mutation of keys or indexes,
+// and on every successful Manager.CompareAndSwap. Use it with CompareAndSwap for optimistic concurrency control.
+func (e *Element) Version() uint64 {
+	return atomic.LoadUint64(&e.version)
 }
 
 // SetInitialization defines the Element's initialization function.
 // The initialization function should be call only once, the input context param will pass to the function.
-func (e *Element) SetInitialization(c context.Context, f func(context.Context) error) {
-	ctx, cancel := context.WithCancel(c)
-	e.initial = &Initialization{
-		f:      f,
-		c:      ctx,
-		cancel: cancel,
-	}
+// The options control the timeout and retry of the initialization, see InitializationOption for more details.
+// The context passed to the function will be canceled when the Element leaves the Manager.
+func (e *Element) SetInitialization(c context.Context, f func(context.Context) error, options ...InitializationOption) {
+	e.initial = newInitialization(c, f, options...)
+}
+
+// SetFinalization defines the Element's finalization function, it's the cleanup of initialization.
+// The function will be called when the Element leaves the Manager by Leave, Remove, Clear or eviction.
+// If the Element has initialization, the function will be called after the initialization returned,
+// it's called in another goroutine when the initialization is still running as the Element leaves.
+func (e *Element) SetFinalization(f func()) {
+	e.final = f
 }
 
 // Meta implements the ELEMENT interface, so it's used in embed scenes.See testing case and example for more Details.
@@ -132,59 +165,3 @@ func (e *Element) Meta() *Element {
 func (e *Element) Initialization() *Initialization {
 	return e.initial
 }
-
-// Initialization controls the operation of the Element initialization.
-type Initialization struct {
-	f      func(context.Context) error
-	c      context.Context
-	cancel context.CancelFunc
-	err    atomic.Value
-}
-
-func (i *Initialization) do() {
-	err := i.f(i.c)
-	if err != nil {
-		i.err.Store(err)
-	} else {
-		i.err.Store(errNil)
-	}
-	i.cancel()
-}
-
-// Wait is called for waiting initialization completed.If it returns an error, that means the operation is failed.
-// This method's error is from initialization function's return.
-func (i *Initialization) Wait() error {
-	return i.WaitWithContext(context.Background())
-}
-
-// WaitWithContext accepts an input context param for controlling the Wait.
-func (i *Initialization) WaitWithContext(c context.Context) error {
-	select {
-	case <-c.Done():
-		return c.Err()
-	case <-i.c.Done():
-		return i.Err()
-	}
-}
-
-// Done is the signal channel for initialize function done notifying.
-func (i *Initialization) Done() <-chan struct{} {
-	return i.c.Done()
-}
-
-// Err return the error for initialize function.
-func (i *Initialization) Err() error {
-	v := i.err.Load()
-	if v == nil {
-		return i.c.Err()
-	}
-	err := v.(error)
-	if err == errNil {
-		return nil
-	}
-	return err
-}
-
-var (
-	errNil = errors.New("nil")
-)
@@ -0,0 +1,388 @@
+package element
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+type EvictionPolicy string
+
+func (p EvictionPolicy) String() string {
+	return string(p)
+}
+
+const (
+	// EvictionReject rejects the joining ELEMENT when the Manager is full, Join returns nil.
+	EvictionReject EvictionPolicy = "reject"
+
+	// EvictionLRU evicts the least recently used ELEMENT when the Manager is full.
+	EvictionLRU EvictionPolicy = "lru"
+
+	// EvictionLFU evicts the least frequently used ELEMENT when the Manager is full.
+	// The least recently used one will be evicted when there are several ELEMENTS have the same frequency.
+	EvictionLFU EvictionPolicy = "lfu"
+
+	// EvictionFIFO evicts the earliest joined ELEMENT when the Manager is full.
+	EvictionFIFO EvictionPolicy = "fifo"
+)
+
+// evictor tracks the ELEMENTS usage in Manager and chooses the victim when the Manager is full.
+type evictor interface {
+	add(id uint64)
+	touch(id uint64)
+	remove(id uint64)
+	victim() (uint64, bool)
+	// position returns where the id is, which is used for restoring it to the same place after removed.
+	position(id uint64) (evictPosition, bool)
+	restore(id uint64, pos evictPosition)
+}
+
+// evictPosition is the place of an id in evictor, next is the id closer to the victim after it,
+// it's the victim when last is true.
+type evictPosition struct {
+	freq int
+	next uint64
+	last bool
+}
+
+func newEvictor(policy EvictionPolicy) evictor {
+	switch policy {
+	case EvictionLRU:
+		return newListEvictor(true)
+	case EvictionLFU:
+		return newLFUEvictor()
+	case EvictionFIFO:
+		return newListEvictor(false)
+	default:
+		return nil
+	}
+}
+
+// eviction controls the capacity of Manager, all fields are guarded by the Manager's lock,
+// except the evictor and journal which could be touched by readers, so they're read and written only with mu held.
+type eviction struct {
+	capacity  int
+	maxWeight int64
+	weight    int64
+	weigher   func(ELEMENT) int64
+	policy    EvictionPolicy
+	callback  func(ELEMENT)
+	mu        sync.Mutex
+	evictor   evictor
+	// touching is 1 when the evictor cares about touching, the readers skip touch without the lock otherwise.
+	touching int32
+	// journal records the functions undoing the adding and removing of evictor after begin called, see rollback.
+	journal    []func()
+	journaling bool
+}
+
+func (ev *eviction) enabled() bool {
+	return ev.capacity != 0 || ev.weigher != nil
+}
+
+func (ev *eviction) weightOf(e ELEMENT) int64 {
+	if ev.weigher == nil {
+		return 0
+	}
+	return ev.weigher(e)
+}
+
+func (ev *eviction) full(count int, weight int64) bool {
+	if ev.capacity != 0 && count > ev.capacity {
+		return true
+	}
+	if ev.weigher != nil && weight > ev.maxWeight {
+		return true
+	}
+	return false
+}
+
+func (ev *eviction) add(id uint64) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	if ev.evictor == nil {
+		return
+	}
+	ev.evictor.add(id)
+	if ev.journaling {
+		ev.journal = append(ev.journal, func() {
+			ev.evictor.remove(id)
+		})
+	}
+}
+
+func (ev *eviction) touch(id uint64) {
+	if atomic.LoadInt32(&ev.touching) == 0 {
+		return
+	}
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	if ev.evictor == nil {
+		return
+	}
+	ev.evictor.touch(id)
+}
+
+func (ev *eviction) remove(id uint64) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	if ev.evictor == nil {
+		return
+	}
+	if ev.journaling {
+		if pos, ok := ev.evictor.position(id); ok {
+			ev.journal = append(ev.journal, func() {
+				ev.evictor.restore(id, pos)
+			})
+		}
+	}
+	ev.evictor.remove(id)
+}
+
+func (ev *eviction) victim() (uint64, bool) {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	if ev.evictor == nil {
+		return 0, false
+	}
+	return ev.evictor.victim()
+}
+
+func (ev *eviction) reset() {
+	ev.weight = 0
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	if ev.evictor == nil {
+		return
+	}
+	ev.evictor = newEvictor(ev.policy)
+}
+
+// begin starts recording the adding and removing of evictor, they will be undone by rollback or kept by commit.
+func (ev *eviction) begin() {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.journal = nil
+	ev.journaling = true
+}
+
+// commit stops recording and keeps the changes of evictor since begin called.
+func (ev *eviction) commit() {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	ev.journal = nil
+	ev.journaling = false
+}
+
+// rollback stops recording and restores the evictor to the state when begin called,
+// the ids removed are put back to the same places with the same frequencies.
+func (ev *eviction) rollback() {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	for n := len(ev.journal) - 1; n >= 0; n-- {
+		ev.journal[n]()
+	}
+	ev.journal = nil
+	ev.journaling = false
+}
+
+// ensure creates the evictor if it's not created yet, it returns true when the evictor is created by this call.
+func (ev *eviction) ensure() bool {
+	ev.mu.Lock()
+	defer ev.mu.Unlock()
+	if ev.evictor != nil {
+		return false
+	}
+	ev.evictor = newEvictor(ev.policy)
+	if ev.policy == EvictionLRU || ev.policy == EvictionLFU {
+		atomic.StoreInt32(&ev.touching, 1)
+	}
+	return ev.evictor != nil
+}
+
+// listEvictor keeps ids in a list, the victim is the back of the list.
+// When moveOnTouch is true, the touched id will be moved to the front, which works as LRU, otherwise it's FIFO.
+type listEvictor struct {
+	moveOnTouch bool
+	order       *list.List
+	items       map[uint64]*list.Element
+}
+
+func newListEvictor(moveOnTouch bool) *listEvictor {
+	return &listEvictor{
+		moveOnTouch: moveOnTouch,
+		order:       list.New(),
+		items:       make(map[uint64]*list.Element),
+	}
+}
+
+func (le *listEvictor) add(id uint64) {
+	le.items[id] = le.order.PushFront(id)
+}
+
+func (le *listEvictor) touch(id uint64) {
+	if !le.moveOnTouch {
+		return
+	}
+	if item, ok := le.items[id]; ok {
+		le.order.MoveToFront(item)
+	}
+}
+
+func (le *listEvictor) remove(id uint64) {
+	if item, ok := le.items[id]; ok {
+		le.order.Remove(item)
+		delete(le.items, id)
+	}
+}
+
+func (le *listEvictor) position(id uint64) (evictPosition, bool) {
+	item, ok := le.items[id]
+	if !ok {
+		return evictPosition{}, false
+	}
+	next := item.Next()
+	if next == nil {
+		return evictPosition{last: true}, true
+	}
+	return evictPosition{next: next.Value.(uint64)}, true
+}
+
+// restore puts the id back before the next one, or to the front as add when the next one is not found,
+// which happens when it's touched by the readers.
+func (le *listEvictor) restore(id uint64, pos evictPosition) {
+	if pos.last {
+		le.items[id] = le.order.PushBack(id)
+		return
+	}
+	if next, ok := le.items[pos.next]; ok {
+		le.items[id] = le.order.InsertBefore(id, next)
+		return
+	}
+	le.add(id)
+}
+
+func (le *listEvictor) victim() (uint64, bool) {
+	back := le.order.Back()
+	if back == nil {
+		return 0, false
+	}
+	return back.Value.(uint64), true
+}
+
+// lfuEvictor keeps ids in lists grouped by the access frequency.
+type lfuEvictor struct {
+	minFreq int
+	freqs   map[int]*list.List
+	items   map[uint64]*lfuItem
+}
+
+type lfuItem struct {
+	id   uint64
+	freq int
+	elem *list.Element
+}
+
+func newLFUEvictor() *lfuEvictor {
+	return &lfuEvictor{
+		freqs: make(map[int]*list.List),
+		items: make(map[uint64]*lfuItem),
+	}
+}
+
+func (lf *lfuEvictor) add(id uint64) {
+	item := &lfuItem{
+		id:   id,
+		freq: 1,
+	}
+	item.elem = lf.bucket(1).PushFront(item)
+	lf.items[id] = item
+	lf.minFreq = 1
+}
+
+func (lf *lfuEvictor) touch(id uint64) {
+	item, ok := lf.items[id]
+	if !ok {
+		return
+	}
+	lf.detach(item)
+	item.freq++
+	item.elem = lf.bucket(item.freq).PushFront(item)
+}
+
+func (lf *lfuEvictor) remove(id uint64) {
+	item, ok := lf.items[id]
+	if !ok {
+		return
+	}
+	lf.detach(item)
+	delete(lf.items, id)
+}
+
+func (lf *lfuEvictor) position(id uint64) (evictPosition, bool) {
+	item, ok := lf.items[id]
+	if !ok {
+		return evictPosition{}, false
+	}
+	next := item.elem.Next()
+	if next == nil {
+		return evictPosition{freq: item.freq, last: true}, true
+	}
+	return evictPosition{freq: item.freq, next: next.Value.(*lfuItem).id}, true
+}
+
+// restore puts the id back to the list of its frequency before the next one,
+// or to the front of the list when the next one is not found.
+func (lf *lfuEvictor) restore(id uint64, pos evictPosition) {
+	item := &lfuItem{
+		id:   id,
+		freq: pos.freq,
+	}
+	l := lf.bucket(pos.freq)
+	if next, ok := lf.items[pos.next]; pos.last {
+		item.elem = l.PushBack(item)
+	} else if ok && next.freq == pos.freq {
+		item.elem = l.InsertBefore(item, next.elem)
+	} else {
+		item.elem = l.PushFront(item)
+	}
+	lf.items[id] = item
+	if lf.minFreq == 0 || pos.freq < lf.minFreq {
+		lf.minFreq = pos.freq
+	}
+}
+
+func (lf *lfuEvictor) victim() (uint64, bool) {
+	if len(lf.items) == 0 {
+		return 0, false
+	}
+	l, ok := lf.freqs[lf.minFreq]
+	if !ok {
+		lf.minFreq = 0
+		for freq := range lf.freqs {
+			if lf.minFreq == 0 || freq < lf.minFreq {
+				lf.minFreq = freq
+			}
+		}
+		l = lf.freqs[lf.minFreq]
+	}
+	return l.Back().Value.(*lfuItem).id, true
+}
+
+func (lf *lfuEvictor) bucket(freq int) *list.List {
+	l, ok := lf.freqs[freq]
+	if !ok {
+		l = list.New()
+		lf.freqs[freq] = l
+	}
+	return l
+}
+
+func (lf *lfuEvictor) detach(item *lfuItem) {
+	l := lf.freqs[item.freq]
+	l.Remove(item.elem)
+	if l.Len() == 0 {
+		delete(lf.freqs, item.freq)
+	}
+}
@@ -0,0 +1,153 @@
+package element
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestEvictionReject(t *testing.T) {
+	mgr := NewManager(WithCapacity(10))
+	for i := 0; i != 20; i++ {
+		itm := newKeyItem(mgr, i)
+		e := mgr.Join(itm)
+		if i < 10 && e != itm {
+			t.Fatalf("item[%d] is not joined as expected", i)
+		}
+		if i >= 10 && e != nil {
+			t.Fatalf("item[%d] is not rejected as expected", i)
+		}
+	}
+	if mgr.Count() != 10 {
+		t.Fatalf("Manager.Count()[%d] is not expected[%d]", mgr.Count(), 10)
+	}
+	if mgr.Find(keySeq, "15") != nil {
+		t.Fatal("the key of rejected item is left in Manager")
+	}
+	mgr.SetCapacity(0)
+	if mgr.Join(newKeyItem(mgr, 15)) == nil {
+		t.Fatal("item is rejected after capacity set to unlimited")
+	}
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	testCases := []struct {
+		policy  EvictionPolicy
+		touch   func(mgr *Manager)
+		evicted []int
+	}{
+		{
+			policy:  EvictionFIFO,
+			touch:   func(mgr *Manager) { mgr.Find(keySeq, "0") },
+			evicted: []int{0, 1},
+		},
+		{
+			policy:  EvictionLRU,
+			touch:   func(mgr *Manager) { mgr.Find(keySeq, "0") },
+			evicted: []int{1, 2},
+		},
+		{
+			policy: EvictionLFU,
+			touch: func(mgr *Manager) {
+				for i := 0; i != 3; i++ {
+					mgr.Find(keySeq, strconv.Itoa(i))
+					mgr.Find(keySeq, strconv.Itoa(i))
+				}
+				mgr.Find(keySeq, "3")
+			},
+			evicted: []int{4, 5},
+		},
+	}
+	for _, tc := range testCases {
+		var evicted []int
+		mgr := NewManager(
+			WithCapacity(5),
+			WithEvictionPolicy(tc.policy),
+			WithEvictionCallback(func(e ELEMENT) {
+				evicted = append(evicted, e.(*item).value)
+			}))
+		for i := 0; i != 5; i++ {
+			mgr.Join(newKeyItem(mgr, i))
+		}
+		tc.touch(mgr)
+		for i := 5; i != 7; i++ {
+			itm := newKeyItem(mgr, i)
+			if mgr.Join(itm) != itm {
+				t.Fatalf("policy[%s] item[%d] is not joined", tc.policy, i)
+			}
+		}
+		if mgr.Count() != 5 {
+			t.Fatalf("policy[%s] Manager.Count()[%d] is not expected[%d]", tc.policy, mgr.Count(), 5)
+		}
+		if len(evicted) != len(tc.evicted) {
+			t.Fatalf("policy[%s] evicted%v is not expected%v", tc.policy, evicted, tc.evicted)
+		}
+		for n, v := range tc.evicted {
+			if evicted[n] != v {
+				t.Fatalf("policy[%s] evicted%v is not expected%v", tc.policy, evicted, tc.evicted)
+			}
+			if mgr.Find(keySeq, strconv.Itoa(v)) != nil {
+				t.Fatalf("policy[%s] key of evicted item[%d] is left in Manager", tc.policy, v)
+			}
+		}
+	}
+}
+
+func TestEvictionWeigher(t *testing.T) {
+	mgr := NewManager(
+		WithWeigher(100, func(e ELEMENT) int64 {
+			return int64(e.(*item).value)
+		}),
+		WithEvictionPolicy(EvictionFIFO))
+	for i := 10; i != 50; i += 10 {
+		mgr.Join(newKeyItem(mgr, i))
+	}
+	// 10+20+30 are evicted for 40+60
+	mgr.Join(newKeyItem(mgr, 60))
+	if mgr.Count() != 2 {
+		t.Fatalf("Manager.Count()[%d] is not expected[%d]", mgr.Count(), 2)
+	}
+	if mgr.Join(newKeyItem(mgr, 101)) != nil {
+		t.Fatal("item heavier than max weight is not rejected")
+	}
+	mgr.SetCapacity(1)
+	if mgr.Count() != 1 || mgr.Find(keySeq, "60") == nil {
+		t.Fatal("Manager is not shrunk to capacity by FIFO policy")
+	}
+}
+
+func TestEvictionSetCapacityGet(t *testing.T) {
+	mgr := NewManager(WithEvictionPolicy(EvictionLRU))
+	var ids []uint64
+	for i := 0; i != 100; i++ {
+		itm := newKeyItem(mgr, i)
+		mgr.Join(itm)
+		ids = append(ids, itm.UId())
+	}
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for n := 100; n != 50; n-- {
+			mgr.SetCapacity(n)
+		}
+	}()
+	for i := 0; i != 10; i++ {
+		for _, id := range ids {
+			mgr.Get(id)
+		}
+	}
+	wg.Wait()
+	if mgr.Count() != 51 {
+		t.Fatalf("Manager.Count()[%d] is not expected[%d]", mgr.Count(), 51)
+	}
+}
+
+func newKeyItem(mgr *Manager, value int) *item {
+	itm := &item{
+		Element: mgr.NewElement(),
+		value:   value,
+	}
+	itm.SetKey(keySeq, strconv.Itoa(value))
+	return itm
+}
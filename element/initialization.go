@@ -0,0 +1,219 @@
+package element
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Initialization controls the operation of the Element initialization.
+type Initialization struct {
+	f          func(context.Context) error
+	c          context.Context
+	cancel     context.CancelFunc
+	err        atomic.Value
+	state      atomic.Value
+	attempts   int32
+	once       sync.Once
+	finished   chan struct{}
+	timeout    time.Duration
+	retry      int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	autoLeave  bool
+}
+
+type InitState string
+
+func (s InitState) String() string {
+	return string(s)
+}
+
+const (
+	// InitStatePending means the initialization is waiting for running, the Element may not join the Manager,
+	// or it's waiting for the initialization pool.
+	InitStatePending InitState = "pending"
+
+	// InitStateRunning means the initialization function is running.
+	InitStateRunning InitState = "running"
+
+	// InitStateRetrying means the initialization function has failed, and it's waiting for the backoff to run again.
+	InitStateRetrying InitState = "retrying"
+
+	// InitStateSucceeded means the initialization function returns nil.
+	InitStateSucceeded InitState = "succeeded"
+
+	// InitStateFailed means the initialization function has failed and all retries are exhausted.
+	InitStateFailed InitState = "failed"
+
+	// InitStateCanceled means the initialization is canceled by the context or the Element leaves the Manager.
+	InitStateCanceled InitState = "canceled"
+)
+
+const (
+	DefaultInitBackoff    = 100 * time.Millisecond
+	DefaultInitMaxBackoff = 10 * time.Second
+)
+
+type InitializationOption func(*Initialization)
+
+// WithInitTimeout defines the timeout for each running of the initialization function.
+// The context passed to the function will be done when timeout, the default value 0 means no timeout.
+func WithInitTimeout(timeout time.Duration) InitializationOption {
+	return func(i *Initialization) {
+		i.timeout = timeout
+	}
+}
+
+// WithInitRetry defines the max retry times when the initialization function returns an error.
+// The default value 0 means no retry.
+func WithInitRetry(times int) InitializationOption {
+	return func(i *Initialization) {
+		i.retry = times
+	}
+}
+
+// WithInitBackoff defines the waiting duration before retry, it's doubled after each retry until reaching max.
+// The default value is 100ms and 10s.
+func WithInitBackoff(backoff, max time.Duration) InitializationOption {
+	return func(i *Initialization) {
+		i.backoff = backoff
+		i.maxBackoff = max
+	}
+}
+
+// WithInitAutoLeave makes the Element leave the Manager automatically when the initialization is failed finally.
+func WithInitAutoLeave() InitializationOption {
+	return func(i *Initialization) {
+		i.autoLeave = true
+	}
+}
+
+func newInitialization(c context.Context, f func(context.Context) error, options ...InitializationOption) *Initialization {
+	ctx, cancel := context.WithCancel(c)
+	i := &Initialization{
+		f:          f,
+		c:          ctx,
+		cancel:     cancel,
+		finished:   make(chan struct{}),
+		backoff:    DefaultInitBackoff,
+		maxBackoff: DefaultInitMaxBackoff,
+	}
+	i.state.Store(InitStatePending)
+	for _, op := range options {
+		op(i)
+	}
+	return i
+}
+
+// do runs the initialization function with retry, it only works at the first time called.
+// It returns true when the initialization is failed finally.
+func (i *Initialization) do() bool {
+	var failed bool
+	i.once.Do(func() {
+		failed = i.run()
+	})
+	return failed
+}
+
+func (i *Initialization) run() bool {
+	defer close(i.finished)
+	defer i.cancel()
+	backoff := i.backoff
+	for {
+		if err := i.c.Err(); err != nil {
+			i.finish(InitStateCanceled, err)
+			return false
+		}
+		atomic.AddInt32(&i.attempts, 1)
+		i.state.Store(InitStateRunning)
+		err := i.attempt()
+		if err == nil {
+			i.finish(InitStateSucceeded, errNil)
+			return false
+		}
+		if i.c.Err() != nil {
+			i.finish(InitStateCanceled, err)
+			return false
+		}
+		if int(atomic.LoadInt32(&i.attempts)) > i.retry {
+			i.finish(InitStateFailed, err)
+			return true
+		}
+		i.state.Store(InitStateRetrying)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-i.c.Done():
+			timer.Stop()
+		case <-timer.C:
+		}
+		backoff *= 2
+		if backoff > i.maxBackoff {
+			backoff = i.maxBackoff
+		}
+	}
+}
+
+func (i *Initialization) attempt() error {
+	if i.timeout == 0 {
+		return i.f(i.c)
+	}
+	c, cancel := context.WithTimeout(i.c, i.timeout)
+	defer cancel()
+	return i.f(c)
+}
+
+func (i *Initialization) finish(state InitState, err error) {
+	i.err.Store(err)
+	i.state.Store(state)
+}
+
+// Wait is called for waiting initialization completed.If it returns an error, that means the operation is failed.
+// This method's error is from initialization function's return.
+func (i *Initialization) Wait() error {
+	return i.WaitWithContext(context.Background())
+}
+
+// WaitWithContext accepts an input context param for controlling the Wait.
+func (i *Initialization) WaitWithContext(c context.Context) error {
+	select {
+	case <-c.Done():
+		return c.Err()
+	case <-i.c.Done():
+		return i.Err()
+	}
+}
+
+// Done is the signal channel for initialize function done notifying.
+func (i *Initialization) Done() <-chan struct{} {
+	return i.c.Done()
+}
+
+// Err return the error for initialize function.
+func (i *Initialization) Err() error {
+	v := i.err.Load()
+	if v == nil {
+		return i.c.Err()
+	}
+	err := v.(error)
+	if err == errNil {
+		return nil
+	}
+	return err
+}
+
+// State returns the current state of the initialization, see InitState for more details.
+func (i *Initialization) State() InitState {
+	return i.state.Load().(InitState)
+}
+
+// Attempts returns the times of the initialization function has been called.
+func (i *Initialization) Attempts() int {
+	return int(atomic.LoadInt32(&i.attempts))
+}
+
+var (
+	errNil = errors.New("nil")
+)
@@ -0,0 +1,146 @@
+package element
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInitializationRetry(t *testing.T) {
+	mgr := NewManager()
+	itm := newKeyItem(mgr, 1)
+	var calls int32
+	itm.SetInitialization(context.Background(), func(c context.Context) error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			// wait for timeout in the first two attempts
+			<-c.Done()
+			return c.Err()
+		}
+		return nil
+	}, WithInitTimeout(10*time.Millisecond), WithInitRetry(3), WithInitBackoff(time.Millisecond, 5*time.Millisecond))
+	mgr.Join(itm)
+	initial := itm.Initialization()
+	if err := initial.Wait(); err != nil {
+		t.Fatalf("initialization failed with error: %v", err)
+	}
+	if initial.State() != InitStateSucceeded {
+		t.Fatalf("initialization state[%s] is not expected[%s]", initial.State(), InitStateSucceeded)
+	}
+	if initial.Attempts() != 3 {
+		t.Fatalf("initialization attempts[%d] is not expected[%d]", initial.Attempts(), 3)
+	}
+}
+
+func TestInitializationAutoLeave(t *testing.T) {
+	mgr := NewManager(WithInitializationPool(2))
+	itm := newKeyItem(mgr, 1)
+	errInit := errors.New("init failed")
+	finalized := make(chan struct{})
+	itm.SetInitialization(context.Background(), func(c context.Context) error {
+		return errInit
+	}, WithInitRetry(1), WithInitBackoff(time.Millisecond, time.Millisecond), WithInitAutoLeave())
+	itm.SetFinalization(func() {
+		close(finalized)
+	})
+	mgr.Join(itm)
+	initial := itm.Initialization()
+	if err := initial.Wait(); err != errInit {
+		t.Fatalf("initialization error[%v] is not expected[%v]", err, errInit)
+	}
+	select {
+	case <-finalized:
+	case <-time.After(time.Second):
+		t.Fatal("finalization is not called after initialization failed")
+	}
+	if initial.State() != InitStateFailed || initial.Attempts() != 2 {
+		t.Fatalf("initialization state[%s] attempts[%d] is not expected", initial.State(), initial.Attempts())
+	}
+	if mgr.Find(keySeq, "1") != nil || mgr.Count() != 0 {
+		t.Fatal("item does not leave the Manager after initialization failed")
+	}
+}
+
+func TestFinalization(t *testing.T) {
+	mgr := NewManager(WithInitializationPool(4))
+	var (
+		finalized int32
+		items     []*item
+	)
+	for i := 0; i != 10; i++ {
+		itm := newKeyItem(mgr, i)
+		itm.SetInitialization(context.Background(), func(c context.Context) error {
+			// block until the item leaves
+			<-c.Done()
+			return c.Err()
+		})
+		itm.SetFinalization(func() {
+			if itm.Initialization().State() != InitStateCanceled {
+				t.Errorf("finalization is called with initialization state[%s]", itm.Initialization().State())
+			}
+			atomic.AddInt32(&finalized, 1)
+		})
+		if mgr.Join(itm) != itm {
+			t.Fatalf("item[%d] is not joined", i)
+		}
+		items = append(items, itm)
+	}
+	waitFinalized := func(n int32) bool {
+		for i := 0; i != 100; i++ {
+			if atomic.LoadInt32(&finalized) == n {
+				return true
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		return false
+	}
+	for i := 0; i != 5; i++ {
+		items[i].Leave()
+	}
+	if !waitFinalized(5) {
+		t.Fatalf("finalized[%d] is not expected[%d] after Leave", atomic.LoadInt32(&finalized), 5)
+	}
+	mgr.Clear()
+	if !waitFinalized(10) {
+		t.Fatalf("finalized[%d] is not expected[%d] after Clear", atomic.LoadInt32(&finalized), 10)
+	}
+	if mgr.Join(items[9]) != items[9] || mgr.Count() != 1 {
+		t.Fatal("item could not join again after Clear")
+	}
+}
+
+func TestFinalizationLeaveInInitialization(t *testing.T) {
+	for _, pool := range []int{0, 1} {
+		var options []Option
+		if pool != 0 {
+			options = append(options, WithInitializationPool(pool))
+		}
+		mgr := NewManager(options...)
+		itm := newKeyItem(mgr, 1)
+		finalized := make(chan struct{})
+		itm.SetInitialization(context.Background(), func(c context.Context) error {
+			// the item leaves in its own initialization
+			itm.Leave()
+			return c.Err()
+		})
+		itm.SetFinalization(func() {
+			close(finalized)
+		})
+		joined := make(chan struct{})
+		go func() {
+			mgr.Join(itm)
+			close(joined)
+		}()
+		select {
+		case <-finalized:
+		case <-time.After(time.Second):
+			t.Fatalf("pool[%d] finalization is not called after leaving in initialization", pool)
+		}
+		<-joined
+		if itm.Initialization().State() != InitStateCanceled || mgr.Count() != 0 {
+			t.Fatalf("pool[%d] initialization state[%s] count[%d] is not expected",
+				pool, itm.Initialization().State(), mgr.Count())
+		}
+	}
+}
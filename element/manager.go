@@ -1,10 +1,42 @@
 package element
 
 import (
+	"errors"
+	"github.com/more-infra/base"
 	"sync"
 	"sync/atomic"
 )
 
+const (
+	ErrTypeKeyConflict  = "element.key_conflict"
+	ErrTypeCapacityFull = "element.capacity_full"
+	ErrTypeNotJoined    = "element.not_joined"
+	ErrTypeTxDone       = "element.tx_done"
+
+	ErrTypeVersionConflict = "element.version_conflict"
+	ErrTypeInvalidCursor   = "element.invalid_cursor"
+	ErrTypeUnorderedIndex  = "element.unordered_index"
+
+	ErrTypeUnknownRelation   = "element.unknown_relation"
+	ErrTypeReferenceNotFound = "element.reference_not_found"
+	ErrTypeReferenced        = "element.referenced"
+)
+
+var (
+	ErrKeyConflict  = errors.New("key of element conflicts with the exists element in manager")
+	ErrCapacityFull = errors.New("manager is full, the element is rejected")
+	ErrNotJoined    = errors.New("element is not in the manager")
+	ErrTxDone       = errors.New("transaction has been committed or rolled back")
+
+	ErrVersionConflict = errors.New("version of element has been changed")
+	ErrInvalidCursor   = errors.New("cursor of page is invalid")
+	ErrUnorderedIndex  = errors.New("index is not defined as ordered index")
+
+	ErrUnknownRelation   = errors.New("relation is not defined in manager")
+	ErrReferenceNotFound = errors.New("element referenced is not in the manager of relation")
+	ErrReferenced        = errors.New("element is referenced by other elements with restrict relation")
+)
+
 // Manager is designed for elements manager which like a simple database used, provides CRUD operations.
 // It's the container of elements, and manages they with keys and indexes.
 // Methods of Manager are thread-safe.
@@ -14,24 +46,172 @@ type Manager struct {
 	autoId uint64
 
 	// rw uses to guarantee the thread-safe for methods call.
+	// Every writing of elements, keys and indexes is done with rw locked.
 	rw sync.RWMutex
 
-	// elements manages all ELEMENT object
-	elements map[uint64]ELEMENT
+	// shards manages all ELEMENT object, split by the autoincrement id.
+	shards []*shard
+
+	// count is the elements count in the Manager.
+	count int64
+
+	// cow defines if the Manager keeps an immutable View of elements, which is replaced when elements changed.
+	cow bool
+
+	// view is the latest *View of elements when cow is enabled.
+	view atomic.Value
 
 	// keys manages ELEMENT's keys for Find method when do querying.
 	keys map[string]map[interface{}]uint64
 
+	// constraints manages the unique constraints across multiple index fields for FindComposite method.
+	constraints map[string]*constraint
+
 	// index manages ELEMENT's indexes for Search/SearchEx method when do searing.
 	indexes map[string]map[interface{}]map[uint64]bool
+
+	// ordered manages the sorted values for indexes defined by WithOrderedIndex.
+	ordered map[string]*orderedValues
+
+	// relations are the relations defined by WithRelation, the ELEMENTS of the Manager are the referrers of them.
+	relations map[string]*relation
+
+	// referenced are the relations which reference the ELEMENTS of the Manager.
+	referenced []*relation
+
+	// computed defines the indexes computed by functions of ELEMENT, see WithComputedIndex.
+	computed map[string]func(ELEMENT) []interface{}
+
+	// prefixes manages the prefix tree of string values for indexes defined by WithPrefixIndex.
+	prefixes map[string]*prefixTree
+
+	// eviction controls the capacity of the Manager, it's disabled by default.
+	eviction eviction
+
+	// batch collects the changes of elements when the write lock held, see batch for more details.
+	batch *batch
+
+	// seq is the sequence of ChangeSet committed.
+	seq uint64
+
+	// watchers receive the ChangeSet committed.
+	watchers map[*Watcher]bool
+
+	// initPool limits the count of initializations running concurrently, Join runs initialization synchronously when it's nil.
+	initPool chan struct{}
+}
+
+// NewManager creates a Manager with options.
+// A Manager with default options has one shard and does not keep copy-on-write View,
+// which is suitable for most scenes. See WithShards and WithCopyOnWrite for read-heavy scenes.
+func NewManager(options ...Option) *Manager {
+	m := &Manager{
+		autoId:      0,
+		keys:        make(map[string]map[interface{}]uint64),
+		constraints: make(map[string]*constraint),
+		indexes:     make(map[string]map[interface{}]map[uint64]bool),
+		computed:    make(map[string]func(ELEMENT) []interface{}),
+		prefixes:    make(map[string]*prefixTree),
+		ordered:     make(map[string]*orderedValues),
+		relations:   make(map[string]*relation),
+		watchers:    make(map[*Watcher]bool),
+		eviction: eviction{
+			policy: EvictionReject,
+		},
+	}
+	for _, op := range options {
+		op(m)
+	}
+	if m.shards == nil {
+		m.shards = newShards(1)
+	}
+	if m.eviction.enabled() {
+		m.eviction.ensure()
+	}
+	if m.cow {
+		m.view.Store(emptyView)
+	}
+	return m
+}
+
+type Option func(*Manager)
+
+// WithShards splits the elements into n shards by the autoincrement id of ELEMENT.
+// Get only locks the shard which the ELEMENT is in, so it reduces the contention of readers
+// when there are many goroutines do Get concurrently. The default value is 1.
+func WithShards(n int) Option {
+	if n <= 0 {
+		panic("element manager shards must be greater than zero")
+	}
+	return func(m *Manager) {
+		m.shards = newShards(n)
+	}
+}
+
+// WithCopyOnWrite makes the Manager keeps an immutable View of elements.
+// Each Join, Remove or Clear makes a new copy of elements and replace the View,
+// then View and Get read the View without locking or copying, Snapshot only copies the View without locking.
+// It's suitable for the read-heavy scenes, such as iterating elements frequently but inserting and removing rarely.
+func WithCopyOnWrite() Option {
+	return func(m *Manager) {
+		m.cow = true
+	}
+}
+
+// WithCapacity limits the max count of ELEMENTS in the Manager, the default value 0 means unlimited.
+// When the Manager is full, Join does the action defined by WithEvictionPolicy.
+func WithCapacity(n int) Option {
+	return func(m *Manager) {
+		m.eviction.capacity = n
+	}
+}
+
+// WithWeigher limits the total weight of ELEMENTS in the Manager, such as the memory cost of them.
+// The weigher function is called once when the ELEMENT joins, the weight should not be changed after that.
+// An ELEMENT which weight is greater than max will always be rejected.
+// It could be used together with WithCapacity, the Manager is full when any of them reaches.
+func WithWeigher(max int64, weigher func(ELEMENT) int64) Option {
+	return func(m *Manager) {
+		m.eviction.maxWeight = max
+		m.eviction.weigher = weigher
+	}
+}
+
+// WithEvictionPolicy defines the action when the Manager is full.
+//
+// EvictionReject: reject the joining ELEMENT, Join returns nil.
+//
+// EvictionLRU: evict the least recently used ELEMENTS.
+//
+// EvictionLFU: evict the least frequently used ELEMENTS.
+//
+// EvictionFIFO: evict the earliest joined ELEMENTS.
+//
+// Get, Find, Search and SearchEx are treated as using of the returned ELEMENTS, iterating by Snapshot, View or GroupByIndex is not.
+// The default value is EvictionReject.
+func WithEvictionPolicy(policy EvictionPolicy) Option {
+	return func(m *Manager) {
+		m.eviction.policy = policy
+	}
 }
 
-func NewManager() *Manager {
-	return &Manager{
-		autoId:   0,
-		elements: make(map[uint64]ELEMENT),
-		keys:     make(map[string]map[interface{}]uint64),
-		indexes:  make(map[string]map[interface{}]map[uint64]bool),
+// WithEvictionCallback defines a function called with the ELEMENT evicted by Manager.
+// It's called after the Manager's lock released, so it's safe to operate the Manager in the callback.
+func WithEvictionCallback(f func(ELEMENT)) Option {
+	return func(m *Manager) {
+		m.eviction.callback = f
+	}
+}
+
+// WithInitializationPool makes Join run the initialization of ELEMENT asynchronously,
+// and at most size initializations could be running at the same time.
+// Join returns immediately without waiting for the initialization, use ELEMENT.Initialization().Wait() for waiting it.
+func WithInitializationPool(size int) Option {
+	if size <= 0 {
+		panic("element manager initialization pool size must be greater than zero")
+	}
+	return func(m *Manager) {
+		m.initPool = make(chan struct{}, size)
 	}
 }
 
@@ -53,76 +233,218 @@ func (m *Manager) NewElement() *Element {
 // When multiple threads/goroutine call Join with the same input ELEMENT, only one ELEMENT will be inserted.
 // If the ELEMENT is already exists in the manager(which judges by the autoincrement id of the ELEMENT), it will return the exists ELEMENT.
 // So return value is the inserted ELEMENT or the ELEMENT already exists.
+// When the Manager is full and the EvictionReject policy is set, the ELEMENT will be rejected and nil is returned.
+// Other policies will evict ELEMENTS to make room for the input ELEMENT, and the evicted ELEMENTS are passed to
+// the function defined by WithEvictionCallback.
 //
 // * ---------------- About the Initialization ---------------- *
 //
 // The initialization function will be called only one times when the ELEMENT inserted into Manager successfully, join will wait it complete and return.
+// When the Manager is created with WithInitializationPool, join will return immediately and the initialization runs in the pool.
 // The recommended way is using the returned ELEMENT object, and do ELEMENT.Initialization().Wait(),
 // because the Join will return immediately when the ELEMENT is already exists.
+// If the initialization fails finally with WithInitAutoLeave option, the ELEMENT will leave the Manager.
 func (m *Manager) Join(e ELEMENT) ELEMENT {
+	ee, _ := m.JoinOrError(e)
+	return ee
+}
+
+// JoinOrError is the same as Join, but it returns an error to explain why the ELEMENT is not inserted.
+//
+// When any key or unique constraint of the ELEMENT conflicts, the exists ELEMENT is returned with an ErrKeyConflict error typed
+// ErrTypeKeyConflict, the error has fields "field", "value" and "existing_id" for the conflict.
+//
+// When the Manager is full with EvictionReject policy, nil is returned with an ErrCapacityFull error typed ErrTypeCapacityFull.
+//
+// Nothing of the ELEMENT is left in the Manager when an error returned.
+func (m *Manager) JoinOrError(e ELEMENT) (ELEMENT, error) {
 	meta := e.Meta()
 	if atomic.CompareAndSwapUint32(&meta.in, 1, 1) {
-		return e
+		return e, nil
 	}
-	m.rw.Lock()
+	m.lock()
 	if atomic.CompareAndSwapUint32(&meta.in, 1, 1) {
-		m.rw.Unlock()
-		return e
+		m.unlock()
+		return e, nil
 	}
-	ee, ok := m.elements[meta.id]
+	ee, ok := m.element(meta.id)
 	if ok {
-		m.rw.Unlock()
-		return ee
+		m.unlock()
+		return ee, nil
 	}
-	// insert keys
-	for f, vv := range meta.keys {
-		_, ok := m.keys[f]
-		if !ok {
-			m.keys[f] = make(map[interface{}]uint64)
+	// the indexes and version changed by computing are restored when it's not joined, as Tx.Join does
+	indexes, version := meta.indexes, atomic.LoadUint64(&meta.version)
+	m.compute(e)
+	var evicted []ELEMENT
+	err := m.refer(e)
+	if err == nil {
+		if ee, evicted, err = m.insert(e, true); err != nil {
+			m.unrefer(meta)
 		}
-		for _, v := range vv {
-			id, ok := m.keys[f][v]
-			if ok {
-				e := m.elements[id]
-				m.rw.Unlock()
-				return e
+	}
+	if err != nil {
+		meta.indexes = indexes
+		atomic.StoreUint64(&meta.version, version)
+	}
+	m.unlock()
+	m.evicted(evicted)
+	if err != nil {
+		return ee, err
+	}
+	m.startInitialization(meta)
+	return e, nil
+}
+
+// insert checks the keys, unique constraints and capacity, and then inserts the ELEMENT to Manager.
+// When reserve is true, ELEMENTS will be evicted by the policy when the Manager is full,
+// otherwise the capacity will not be checked, the caller should do shrink later.
+// It returns the exists ELEMENT and error when the ELEMENT could not be inserted.
+// The caller must hold the write lock of Manager and make sure the ELEMENT is not in the Manager.
+func (m *Manager) insert(e ELEMENT, reserve bool) (ELEMENT, []ELEMENT, error) {
+	meta := e.Meta()
+	// check keys and unique constraints
+	composites := m.composites(meta)
+	if ee, err := m.conflict(meta.id, meta.keys, composites); err != nil {
+		return ee, nil, err
+	}
+	// check capacity
+	var evicted []ELEMENT
+	if m.eviction.enabled() {
+		weight := m.eviction.weightOf(e)
+		if m.eviction.weigher != nil && weight > m.eviction.maxWeight {
+			return nil, nil, m.errCapacityFull(meta)
+		}
+		if reserve {
+			var ok bool
+			evicted, ok = m.shrink(1, weight)
+			if !ok {
+				return nil, evicted, m.errCapacityFull(meta)
 			}
-			m.keys[f][v] = meta.id
 		}
+		meta.weight = weight
+		m.eviction.weight += weight
+		m.eviction.add(meta.id)
 	}
-	// insert indexes
-	for f, vv := range meta.indexes {
-		_, ok := m.indexes[f]
-		if !ok {
-			m.indexes[f] = make(map[interface{}]map[uint64]bool)
+	m.link(meta, composites)
+	m.storeElement(meta.id, e)
+	m.batch.record(ChangeJoin, e)
+	return e, evicted, nil
+}
+
+// startInitialization runs the initialization of the Element joined, synchronously or in the pool.
+func (m *Manager) startInitialization(meta *Element) {
+	if meta.initial == nil {
+		return
+	}
+	if m.initPool == nil {
+		m.initialize(meta)
+		return
+	}
+	go func() {
+		select {
+		case m.initPool <- struct{}{}:
+			defer func() {
+				<-m.initPool
+			}()
+		case <-meta.initial.c.Done():
+			// the initialization is canceled before running, it will finish immediately without the pool
 		}
+		m.initialize(meta)
+	}()
+}
+
+// conflict checks the keys and composite values of unique constraints, it returns the exists ELEMENT and error when conflicts.
+// The values which belong to the self id are not treated as conflicts. The caller must hold the lock of Manager.
+func (m *Manager) conflict(self uint64, keys map[string][]interface{}, composites map[string][]interface{}) (ELEMENT, error) {
+	for f, vv := range keys {
 		for _, v := range vv {
-			ids, ok := m.indexes[f][v]
-			if !ok {
-				ids = make(map[uint64]bool)
+			if id, ok := m.keys[f][v]; ok && id != self {
+				return m.errKeyConflict(f, v, id)
 			}
-			ids[meta.id] = true
-			m.indexes[f][v] = ids
 		}
 	}
-	m.elements[meta.id] = e
-	atomic.StoreUint32(&meta.in, 1)
-	m.rw.Unlock()
+	for name, vv := range composites {
+		values := m.constraints[name].values
+		for _, v := range vv {
+			if id, ok := values[v]; ok && id != self {
+				return m.errKeyConflict(name, v.(compositeValue).values(), id)
+			}
+		}
+	}
+	return nil, nil
+}
+
+func (m *Manager) errKeyConflict(field string, value interface{}, id uint64) (ELEMENT, error) {
+	e, _ := m.element(id)
+	return e, base.NewErrorWithType(ErrTypeKeyConflict, ErrKeyConflict).
+		WithField("field", field).
+		WithField("value", value).
+		WithField("existing_id", id)
+}
+
+func (m *Manager) errNotJoined(e *Element) error {
+	return base.NewErrorWithType(ErrTypeNotJoined, ErrNotJoined).
+		WithField("id", e.id)
+}
+
+func (m *Manager) errCapacityFull(meta *Element) error {
+	return base.NewErrorWithType(ErrTypeCapacityFull, ErrCapacityFull).
+		WithField("id", meta.id).
+		WithField("capacity", m.eviction.capacity).
+		WithField("max_weight", m.eviction.maxWeight)
+}
+
+func (m *Manager) initialize(meta *Element) {
+	initial := meta.initial
+	if initial.do() && initial.autoLeave {
+		m.Remove(meta)
+	}
+}
+
+// finalize cancels the initialization of the Element and calls its finalization function.
+// It must be called without the lock of Manager held, and the Element must have joined the Manager,
+// so the initialization has been called or will be called soon.
+// When the initialization has not finished, the finalization function is called in a goroutine after that,
+// as the Element may leave in its own initialization function, waiting here will cause deadlock.
+func (m *Manager) finalize(meta *Element) {
 	initial := meta.initial
 	if initial != nil {
-		initial.do()
+		initial.cancel()
 	}
-	return e
+	final := meta.final
+	if final == nil {
+		return
+	}
+	if initial != nil {
+		select {
+		case <-initial.finished:
+		default:
+			go func() {
+				<-initial.finished
+				final()
+			}()
+			return
+		}
+	}
+	final()
 }
 
 // Get finds the element by unique autoincrement id
 func (m *Manager) Get(id uint64) ELEMENT {
-	m.rw.RLock()
-	defer m.rw.RUnlock()
-	e, ok := m.elements[id]
+	var (
+		e  ELEMENT
+		ok bool
+	)
+	if m.cow {
+		e = m.View().Get(id)
+		ok = e != nil
+	} else {
+		e, ok = m.shardOf(id).get(id)
+	}
 	if !ok {
 		return nil
 	}
+	m.eviction.touch(id)
 	return e
 }
 
@@ -131,6 +453,11 @@ func (m *Manager) Get(id uint64) ELEMENT {
 func (m *Manager) Find(unique string, value interface{}) ELEMENT {
 	m.rw.RLock()
 	defer m.rw.RUnlock()
+	return m.find(unique, value)
+}
+
+// find query the ELEMENT with key, the caller must hold the lock of Manager.
+func (m *Manager) find(unique string, value interface{}) ELEMENT {
 	ref, ok := m.keys[unique]
 	if !ok {
 		return nil
@@ -139,7 +466,9 @@ func (m *Manager) Find(unique string, value interface{}) ELEMENT {
 	if !ok {
 		return nil
 	}
-	return m.elements[id]
+	e, _ := m.element(id)
+	m.eviction.touch(id)
+	return e
 }
 
 // SearchEx enhances multiple indexes searching with relationship than Search.
@@ -191,7 +520,8 @@ func (m *Manager) SearchEx(indexes map[string][]interface{}, relation SearchInde
 	els := make([]ELEMENT, len(elIds), len(elIds))
 	n := 0
 	for id := range elIds {
-		els[n] = m.elements[id]
+		els[n], _ = m.element(id)
+		m.eviction.touch(id)
 		n++
 	}
 	return els
@@ -201,6 +531,11 @@ func (m *Manager) SearchEx(indexes map[string][]interface{}, relation SearchInde
 func (m *Manager) Search(index string, value interface{}) []ELEMENT {
 	m.rw.RLock()
 	defer m.rw.RUnlock()
+	return m.search(index, value)
+}
+
+// search finds the ELEMENTS by index, the caller must hold the lock of Manager.
+func (m *Manager) search(index string, value interface{}) []ELEMENT {
 	var els []ELEMENT
 	ref, ok := m.indexes[index]
 	if !ok {
@@ -211,12 +546,15 @@ func (m *Manager) Search(index string, value interface{}) []ELEMENT {
 		return els
 	}
 	for id := range ids {
-		els = append(els, m.elements[id])
+		e, _ := m.element(id)
+		m.eviction.touch(id)
+		els = append(els, e)
 	}
 	return els
 }
 
 // GroupByIndex groups elements by input index, the return map is always no-nil(may an empty map)
+// Use CountByIndex instead when only the count of each group is required.
 func (m *Manager) GroupByIndex(index string) map[interface{}][]ELEMENT {
 	m.rw.RLock()
 	defer m.rw.RUnlock()
@@ -228,7 +566,8 @@ func (m *Manager) GroupByIndex(index string) map[interface{}][]ELEMENT {
 	for v, ids := range ref {
 		var ee []ELEMENT
 		for id := range ids {
-			ee = append(ee, m.elements[id])
+			e, _ := m.element(id)
+			ee = append(ee, e)
 		}
 		els[v] = ee
 	}
@@ -238,66 +577,296 @@ func (m *Manager) GroupByIndex(index string) map[interface{}][]ELEMENT {
 // Snapshot makes a copy of current elements in Manager.
 // It's usually used for iterating scenes.See testing case and example for more details.
 func (m *Manager) Snapshot() map[uint64]ELEMENT {
-	copys := make(map[uint64]ELEMENT)
+	if m.cow {
+		view := m.View()
+		copys := make(map[uint64]ELEMENT, len(view.elements))
+		for k, v := range view.elements {
+			copys[k] = v
+		}
+		return copys
+	}
 	m.rw.RLock()
-	for k, v := range m.elements {
-		copys[k] = v
+	copys := make(map[uint64]ELEMENT, m.Count())
+	for _, s := range m.shards {
+		for k, v := range s.elements {
+			copys[k] = v
+		}
 	}
 	m.rw.RUnlock()
 	return copys
 }
 
+// View returns an immutable View of current elements in Manager.
+// When the Manager is created with WithCopyOnWrite, it returns the shared View without copying,
+// otherwise it makes a copy as Snapshot does. The View must not be modified, it's read-only.
+func (m *Manager) View() *View {
+	if m.cow {
+		return m.view.Load().(*View)
+	}
+	return &View{
+		elements: m.Snapshot(),
+	}
+}
+
 // Count returns the elements count in the Manager.
 func (m *Manager) Count() int {
-	m.rw.RLock()
-	count := len(m.elements)
-	m.rw.RUnlock()
-	return count
+	return int(atomic.LoadInt64(&m.count))
 }
 
 // Empty used to check if the Manager has any elements.
 func (m *Manager) Empty() bool {
-	m.rw.RLock()
-	empty := len(m.elements) == 0
-	m.rw.RUnlock()
-	return empty
+	return m.Count() == 0
 }
 
 // Remove is used to remove an Element in Manager.
+// The initialization of the Element will be canceled, and the finalization function will be called after it returned.
+// The Element is not removed when it's referenced by a relation with RelationRestrict, use RemoveOrError to get the error.
 // * Notice: the input param type is *Element not ELEMENT.
 func (m *Manager) Remove(e *Element) {
+	_ = m.RemoveOrError(e)
+}
+
+// RemoveOrError is the same as Remove, but it returns ErrReferenced typed ErrTypeReferenced when the Element
+// is referenced by any ELEMENT with a relation defined by WithRelation with RelationRestrict.
+// The error has fields "relation", "id" and "referrers".
+func (m *Manager) RemoveOrError(e *Element) error {
 	if atomic.CompareAndSwapUint32(&e.in, 0, 0) {
-		return
+		return nil
 	}
-	m.rw.Lock()
-	defer m.rw.Unlock()
+	m.lock()
 	if atomic.CompareAndSwapUint32(&e.in, 0, 0) {
-		return
+		m.unlock()
+		return nil
+	}
+	if ee, ok := m.element(e.id); ok {
+		if err := m.restrict(e); err != nil {
+			m.unlock()
+			return err
+		}
+		m.remove(e)
+		m.batch.record(ChangeRemove, ee)
 	}
-	defer atomic.StoreUint32(&e.in, 0)
+	m.unlock()
+	m.finalize(e)
+	return nil
+}
+
+// SetCapacity set the max count of ELEMENTS in the Manager dynamically, 0 means unlimited.
+// When the count of ELEMENTS exceeds the new capacity, ELEMENTS will be evicted by the policy,
+// but nothing will be evicted with EvictionReject policy, the later Join will be rejected until the count is reduced.
+func (m *Manager) SetCapacity(n int) {
+	m.lock()
+	m.eviction.capacity = n
+	if m.eviction.enabled() && m.eviction.ensure() {
+		for _, s := range m.shards {
+			for id := range s.elements {
+				m.eviction.add(id)
+			}
+		}
+	}
+	evicted, _ := m.shrink(0, 0)
+	m.unlock()
+	m.evicted(evicted)
+}
+
+// remove deletes the element from Manager, the caller must hold the write lock of Manager
+// and make sure the element is in the Manager.
+func (m *Manager) remove(e *Element) {
 	id := e.id
-	_, ok := m.elements[id]
-	if !ok {
-		return
+	m.unlink(e)
+	m.unrefer(e)
+	m.deleteElement(id)
+	m.eviction.remove(id)
+	m.eviction.weight -= e.weight
+}
+
+// restore puts the element removed back to Manager when the Tx is rolled back, the evictor is restored by the Tx itself,
+// and the change is not recorded. The caller must hold the write lock of Manager.
+func (m *Manager) restore(e ELEMENT) {
+	meta := e.Meta()
+	if m.eviction.enabled() {
+		m.eviction.weight += meta.weight
 	}
-	for f, vv := range e.indexes {
-		for _, v := range vv {
-			delete(m.indexes[f][v], id)
+	m.link(meta, m.composites(meta))
+	m.storeElement(meta.id, e)
+}
+
+// shrink evicts ELEMENTS by the policy until the Manager could hold more count and weight of ELEMENTS.
+// It returns false when the room could not be made, the caller must hold the write lock of Manager.
+func (m *Manager) shrink(count int, weight int64) ([]ELEMENT, bool) {
+	var evicted []ELEMENT
+	for m.eviction.full(m.size()+count, m.eviction.weight+weight) {
+		id, ok := m.eviction.victim()
+		if !ok {
+			return evicted, false
 		}
+		victim, _ := m.element(id)
+		m.remove(victim.Meta())
+		m.batch.record(ChangeEvict, victim)
+		evicted = append(evicted, victim)
 	}
-	for f, vv := range e.keys {
-		for _, v := range vv {
-			delete(m.keys[f], v)
+	return evicted, true
+}
+
+func (m *Manager) evicted(ee []ELEMENT) {
+	for _, e := range ee {
+		m.finalize(e.Meta())
+		if m.eviction.callback != nil {
+			m.eviction.callback(e)
 		}
 	}
-	delete(m.elements, id)
 }
 
 // Clear will reset the Manager and clean all ELEMENTS in it.
+// The finalization functions of ELEMENTS will be called after the Manager cleaned.
 func (m *Manager) Clear() {
-	m.rw.Lock()
-	defer m.rw.Unlock()
-	m.elements = make(map[uint64]ELEMENT)
+	m.lock()
+	var cleared []*Element
+	for _, s := range m.shards {
+		m.batch.lockShard(s)
+		for id, e := range s.elements {
+			m.batch.touched[id] = touched{e: e, in: false}
+			cleared = append(cleared, e.Meta())
+		}
+		m.batch.delta -= int64(len(s.elements))
+		s.elements = make(map[uint64]ELEMENT)
+	}
+	m.batch.cleared = true
+	m.batch.record(ChangeClear, nil)
+	m.eviction.reset()
 	m.keys = make(map[string]map[interface{}]uint64)
 	m.indexes = make(map[string]map[interface{}]map[uint64]bool)
+	for _, c := range m.constraints {
+		c.values = make(map[interface{}]uint64)
+	}
+	for _, tree := range m.prefixes {
+		tree.reset()
+	}
+	for _, ordered := range m.ordered {
+		ordered.reset()
+	}
+	for _, r := range m.relations {
+		r.reset()
+	}
+	m.unlock()
+	for _, meta := range cleared {
+		m.finalize(meta)
+	}
+}
+
+// link inserts the keys, composite values of unique constraints and indexes of the element to Manager.
+// The caller must hold the write lock of Manager and make sure they do not conflict.
+func (m *Manager) link(meta *Element, composites map[string][]interface{}) {
+	for f, vv := range meta.keys {
+		_, ok := m.keys[f]
+		if !ok {
+			m.keys[f] = make(map[interface{}]uint64)
+		}
+		for _, v := range vv {
+			m.keys[f][v] = meta.id
+		}
+	}
+	meta.composites = composites
+	for name, vv := range composites {
+		for _, v := range vv {
+			m.constraints[name].values[v] = meta.id
+		}
+	}
+	for f, vv := range meta.indexes {
+		for _, v := range vv {
+			m.addIndex(f, v, meta.id)
+		}
+	}
+}
+
+// unlink deletes the keys, composite values of unique constraints and indexes of the element from Manager.
+// The caller must hold the write lock of Manager.
+func (m *Manager) unlink(meta *Element) {
+	for f, vv := range meta.indexes {
+		for _, v := range vv {
+			m.removeIndex(f, v, meta.id)
+		}
+	}
+	for f, vv := range meta.keys {
+		for _, v := range vv {
+			delete(m.keys[f], v)
+		}
+	}
+	for name, vv := range meta.composites {
+		for _, v := range vv {
+			delete(m.constraints[name].values, v)
+		}
+	}
+	meta.composites = nil
+}
+
+// addIndex inserts the id to the index value, the caller must hold the write lock of Manager.
+func (m *Manager) addIndex(field string, value interface{}, id uint64) {
+	ref, ok := m.indexes[field]
+	if !ok {
+		ref = make(map[interface{}]map[uint64]bool)
+		m.indexes[field] = ref
+	}
+	ids, ok := ref[value]
+	if !ok {
+		ids = make(map[uint64]bool)
+		ref[value] = ids
+		if tree, ok := m.prefixes[field]; ok {
+			tree.add(value)
+		}
+		if ordered, ok := m.ordered[field]; ok {
+			ordered.add(value)
+		}
+	}
+	ids[id] = true
+}
+
+// removeIndex deletes the id from the index value, the value will be deleted when no ids left.
+// The caller must hold the write lock of Manager.
+func (m *Manager) removeIndex(field string, value interface{}, id uint64) {
+	ids, ok := m.indexes[field][value]
+	if !ok {
+		return
+	}
+	delete(ids, id)
+	if len(ids) == 0 {
+		delete(m.indexes[field], value)
+		if tree, ok := m.prefixes[field]; ok {
+			tree.remove(value)
+		}
+		if ordered, ok := m.ordered[field]; ok {
+			ordered.remove(value)
+		}
+	}
+}
+
+func (m *Manager) shardOf(id uint64) *shard {
+	return m.shards[id%uint64(len(m.shards))]
+}
+
+// element finds the element by id, the caller must hold the lock of Manager.
+func (m *Manager) element(id uint64) (ELEMENT, bool) {
+	e, ok := m.shardOf(id).elements[id]
+	return e, ok
+}
+
+// storeElement saves the element to its shard, the caller must hold the write lock of Manager.
+func (m *Manager) storeElement(id uint64, e ELEMENT) {
+	m.batch.lockShard(m.shardOf(id)).elements[id] = e
+	m.batch.touched[id] = touched{e: e, in: true}
+	m.batch.delta++
+}
+
+// deleteElement removes the element from its shard, the caller must hold the write lock of Manager.
+func (m *Manager) deleteElement(id uint64) {
+	s := m.batch.lockShard(m.shardOf(id))
+	e := s.elements[id]
+	delete(s.elements, id)
+	m.batch.touched[id] = touched{e: e, in: false}
+	m.batch.delta--
+}
+
+// size returns the count of elements including the changes in batch, the caller must hold the write lock of Manager.
+func (m *Manager) size() int {
+	return m.Count() + int(m.batch.delta)
 }
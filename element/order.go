@@ -0,0 +1,193 @@
+package element
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// WithOrderedIndex keeps the values of the index fields sorted, so Page could iterate ELEMENTS in the order of the index.
+// Values are ordered by numbers first, then strings, then time.Time, then other types ordered by their type names and formatted strings.
+// Numbers of different types are compared by their values, such as int 1 and float64 1.0 are the same position.
+// It costs more time when a new value is added or the last ELEMENT of a value leaves, only set it for the fields paged frequently.
+func WithOrderedIndex(fields ...string) Option {
+	return func(m *Manager) {
+		for _, f := range fields {
+			m.ordered[f] = &orderedValues{}
+		}
+	}
+}
+
+// orderedValues saves the distinct values of an index in ascending order.
+type orderedValues struct {
+	values []interface{}
+}
+
+func (o *orderedValues) reset() {
+	o.values = nil
+}
+
+func (o *orderedValues) add(value interface{}) {
+	n := o.search(value)
+	o.values = append(o.values, nil)
+	copy(o.values[n+1:], o.values[n:])
+	o.values[n] = value
+}
+
+func (o *orderedValues) remove(value interface{}) {
+	for n := o.search(value); n != len(o.values) && compareValues(o.values[n], value) == 0; n++ {
+		if o.values[n] == value {
+			o.values = append(o.values[:n], o.values[n+1:]...)
+			return
+		}
+	}
+}
+
+// search returns the position of the first value which is not less than value.
+func (o *orderedValues) search(value interface{}) int {
+	return sort.Search(len(o.values), func(n int) bool {
+		return compareValues(o.values[n], value) >= 0
+	})
+}
+
+// group returns the end position of the values which are equal to the value at the start position.
+func (o *orderedValues) group(start int) int {
+	end := start + 1
+	for end != len(o.values) && compareValues(o.values[end], o.values[start]) == 0 {
+		end++
+	}
+	return end
+}
+
+const (
+	rankNumber = iota
+	rankString
+	rankTime
+	rankOther
+)
+
+// otherValue is the position of the value which type is not supported by compareValues natively, it's used in cursor.
+type otherValue struct {
+	typ string
+	str string
+}
+
+func rankOf(v interface{}) int {
+	switch v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, uintptr, float32, float64:
+		return rankNumber
+	case string:
+		return rankString
+	case time.Time:
+		return rankTime
+	default:
+		return rankOther
+	}
+}
+
+// compareValues returns -1, 0 or 1 when a is less than, equal to or greater than b in the order of ordered index.
+func compareValues(a interface{}, b interface{}) int {
+	ra, rb := rankOf(a), rankOf(b)
+	if ra != rb {
+		return compareInt(int64(ra), int64(rb))
+	}
+	switch ra {
+	case rankNumber:
+		return compareNumbers(reflect.ValueOf(a), reflect.ValueOf(b))
+	case rankString:
+		return strings.Compare(a.(string), b.(string))
+	case rankTime:
+		ta, tb := a.(time.Time), b.(time.Time)
+		switch {
+		case ta.Before(tb):
+			return -1
+		case ta.After(tb):
+			return 1
+		default:
+			return 0
+		}
+	default:
+		oa, ob := toOtherValue(a), toOtherValue(b)
+		if c := strings.Compare(oa.typ, ob.typ); c != 0 {
+			return c
+		}
+		return strings.Compare(oa.str, ob.str)
+	}
+}
+
+func toOtherValue(v interface{}) otherValue {
+	if ov, ok := v.(otherValue); ok {
+		return ov
+	}
+	return otherValue{
+		typ: fmt.Sprintf("%T", v),
+		str: fmt.Sprint(v),
+	}
+}
+
+func compareNumbers(a reflect.Value, b reflect.Value) int {
+	switch {
+	case a.CanInt() && b.CanInt():
+		return compareInt(a.Int(), b.Int())
+	case a.CanUint() && b.CanUint():
+		return compareUint(a.Uint(), b.Uint())
+	case a.CanInt() && b.CanUint():
+		if a.Int() < 0 {
+			return -1
+		}
+		return compareUint(uint64(a.Int()), b.Uint())
+	case a.CanUint() && b.CanInt():
+		if b.Int() < 0 {
+			return 1
+		}
+		return compareUint(a.Uint(), uint64(b.Int()))
+	default:
+		return compareFloat(toFloat(a), toFloat(b))
+	}
+}
+
+func toFloat(v reflect.Value) float64 {
+	switch {
+	case v.CanInt():
+		return float64(v.Int())
+	case v.CanUint():
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+func compareInt(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareUint(a uint64, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+func compareFloat(a float64, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,371 @@
+package element
+
+import (
+	"container/heap"
+	"encoding/json"
+	"fmt"
+	"github.com/more-infra/base"
+	algoutil "github.com/more-infra/base/util/algo"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultPageSize is the count of ELEMENTS in a Page when WithPageSize is not set.
+	DefaultPageSize = 100
+
+	// MaxPageSize is the max count of ELEMENTS in a Page, a greater size set by WithPageSize is limited to it.
+	MaxPageSize = 1000
+)
+
+// Page is a part of ELEMENTS returned by Manager.Page in a deterministic order.
+type Page struct {
+	// Elements are the ELEMENTS of the page in order.
+	Elements []ELEMENT
+
+	// Next is the opaque cursor for the next page, pass it to WithPageCursor to continue iterating.
+	// It's empty when there are no more ELEMENTS.
+	Next string
+}
+
+type pageOptions struct {
+	size    int
+	cursor  string
+	reverse bool
+	index   string
+}
+
+type PageOption func(*pageOptions)
+
+// WithPageSize limits the count of ELEMENTS in a Page, the default value is DefaultPageSize and the max value is MaxPageSize.
+func WithPageSize(n int) PageOption {
+	return func(o *pageOptions) {
+		o.size = n
+	}
+}
+
+// WithPageCursor makes the Page start after the position of the cursor, which is Page.Next returned by the previous Page.
+// The cursor must be returned by the Page with the same index set by WithPageOrderBy.
+func WithPageCursor(cursor string) PageOption {
+	return func(o *pageOptions) {
+		o.cursor = cursor
+	}
+}
+
+// WithPageReverse iterates the ELEMENTS in descending order.
+// With a cursor, the Page returns the ELEMENTS before the position of the cursor in descending order.
+func WithPageReverse() PageOption {
+	return func(o *pageOptions) {
+		o.reverse = true
+	}
+}
+
+// WithPageOrderBy iterates the ELEMENTS in the order of index values, the index must be defined by WithOrderedIndex.
+// ELEMENTS with the same value are ordered by their unique autoincrement id, and the ELEMENTS without the index are not iterated.
+// An ELEMENT with multiple values of the index appears at the position of each value.
+// The ELEMENTS are ordered by the unique autoincrement id when it's not set.
+func WithPageOrderBy(index string) PageOption {
+	return func(o *pageOptions) {
+		o.index = index
+	}
+}
+
+// Page returns a part of ELEMENTS ordered by the unique autoincrement id or an ordered index, see PageOption for details.
+// The position of cursor does not depend on the ELEMENTS in Manager, so the iteration is stable when ELEMENTS join or leave:
+// each ELEMENT which is in the Manager during the whole iteration is returned exactly once,
+// and the ELEMENTS joined after the cursor position will be returned by the later pages.
+// It returns ErrInvalidCursor when the cursor could not be decoded or is returned by the Page with another index,
+// and ErrUnorderedIndex when the index is not defined by WithOrderedIndex.
+func (m *Manager) Page(options ...PageOption) (*Page, error) {
+	opts := &pageOptions{
+		size: DefaultPageSize,
+	}
+	for _, op := range options {
+		op(opts)
+	}
+	if opts.size <= 0 {
+		opts.size = DefaultPageSize
+	}
+	if opts.size > MaxPageSize {
+		opts.size = MaxPageSize
+	}
+	var pos *position
+	if len(opts.cursor) != 0 {
+		var err error
+		pos, err = decodeCursor(opts.cursor, opts.index)
+		if err != nil {
+			return nil, err
+		}
+	}
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	var positions []position
+	if len(opts.index) == 0 {
+		positions = m.pageById(pos, opts)
+	} else {
+		ordered, ok := m.ordered[opts.index]
+		if !ok {
+			return nil, base.NewErrorWithType(ErrTypeUnorderedIndex, ErrUnorderedIndex).
+				WithField("index", opts.index)
+		}
+		positions = m.pageByIndex(ordered, pos, opts)
+	}
+	page := &Page{}
+	for n, p := range positions {
+		if n == opts.size {
+			page.Next = encodeCursor(opts.index, positions[n-1])
+			break
+		}
+		e, _ := m.element(p.id)
+		page.Elements = append(page.Elements, e)
+	}
+	return page, nil
+}
+
+// position is the position of an ELEMENT in the iteration.
+type position struct {
+	value interface{}
+	id    uint64
+}
+
+// pageById returns at most size+1 positions after pos ordered by id, the caller must hold the lock of Manager.
+func (m *Manager) pageById(pos *position, opts *pageOptions) []position {
+	// keeps the first size+1 ids in a heap which top is the last one
+	h := &idHeap{
+		reverse: opts.reverse,
+	}
+	for _, s := range m.shards {
+		for id := range s.elements {
+			if pos != nil && (!opts.reverse && id <= pos.id || opts.reverse && id >= pos.id) {
+				continue
+			}
+			if h.Len() <= opts.size {
+				heap.Push(h, id)
+				continue
+			}
+			if h.less(id, h.ids[0]) {
+				h.ids[0] = id
+				heap.Fix(h, 0)
+			}
+		}
+	}
+	ids := h.ids
+	sort.Slice(ids, func(i, j int) bool {
+		return h.less(ids[i], ids[j])
+	})
+	positions := make([]position, len(ids))
+	for n, id := range ids {
+		positions[n].id = id
+	}
+	return positions
+}
+
+// pageByIndex returns at most size+1 positions after pos ordered by index values, the caller must hold the lock of Manager.
+func (m *Manager) pageByIndex(ordered *orderedValues, pos *position, opts *pageOptions) []position {
+	ref := m.indexes[opts.index]
+	values := ordered.values
+	var positions []position
+	// collect returns false when enough positions collected
+	collect := func(start int, end int) bool {
+		value := values[start]
+		equal := pos != nil && compareValues(value, pos.value) == 0
+		var ids []uint64
+		for n := start; n != end; n++ {
+			for id := range ref[values[n]] {
+				ids = append(ids, id)
+			}
+		}
+		sort.Slice(ids, func(i, j int) bool {
+			if opts.reverse {
+				return ids[i] > ids[j]
+			}
+			return ids[i] < ids[j]
+		})
+		for n, id := range ids {
+			// an ELEMENT with multiple values in the same position only appears once
+			if n != 0 && ids[n-1] == id {
+				continue
+			}
+			if equal && (!opts.reverse && id <= pos.id || opts.reverse && id >= pos.id) {
+				continue
+			}
+			positions = append(positions, position{
+				value: value,
+				id:    id,
+			})
+			if len(positions) > opts.size {
+				return false
+			}
+		}
+		return true
+	}
+	if !opts.reverse {
+		start := 0
+		if pos != nil {
+			start = ordered.search(pos.value)
+		}
+		for start < len(values) {
+			end := ordered.group(start)
+			if !collect(start, end) {
+				break
+			}
+			start = end
+		}
+		return positions
+	}
+	end := len(values)
+	if pos != nil {
+		end = sort.Search(len(values), func(n int) bool {
+			return compareValues(values[n], pos.value) > 0
+		})
+	}
+	for end > 0 {
+		start := end - 1
+		for start > 0 && compareValues(values[start-1], values[end-1]) == 0 {
+			start--
+		}
+		if !collect(start, end) {
+			break
+		}
+		end = start
+	}
+	return positions
+}
+
+// idHeap is a heap of ids which top is the greatest id in the iteration order.
+type idHeap struct {
+	ids     []uint64
+	reverse bool
+}
+
+func (h *idHeap) less(a uint64, b uint64) bool {
+	if h.reverse {
+		return a > b
+	}
+	return a < b
+}
+
+func (h *idHeap) Len() int {
+	return len(h.ids)
+}
+
+func (h *idHeap) Less(i, j int) bool {
+	return h.less(h.ids[j], h.ids[i])
+}
+
+func (h *idHeap) Swap(i, j int) {
+	h.ids[i], h.ids[j] = h.ids[j], h.ids[i]
+}
+
+func (h *idHeap) Push(x interface{}) {
+	h.ids = append(h.ids, x.(uint64))
+}
+
+func (h *idHeap) Pop() interface{} {
+	id := h.ids[len(h.ids)-1]
+	h.ids = h.ids[:len(h.ids)-1]
+	return id
+}
+
+// cursor is the json content of the opaque cursor string.
+type cursor struct {
+	Index string `json:"i,omitempty"`
+	Id    uint64 `json:"id"`
+	Kind  string `json:"k,omitempty"`
+	Type  string `json:"t,omitempty"`
+	Value string `json:"v,omitempty"`
+}
+
+const (
+	cursorKindInt    = "i"
+	cursorKindUint   = "u"
+	cursorKindFloat  = "f"
+	cursorKindString = "s"
+	cursorKindTime   = "t"
+	cursorKindOther  = "x"
+)
+
+func encodeCursor(index string, pos position) string {
+	c := cursor{
+		Index: index,
+		Id:    pos.id,
+	}
+	if len(index) != 0 {
+		switch v := pos.value.(type) {
+		case string:
+			c.Kind, c.Value = cursorKindString, v
+		case time.Time:
+			c.Kind, c.Value = cursorKindTime, v.Format(time.RFC3339Nano)
+		default:
+			if rankOf(v) != rankNumber {
+				ov := toOtherValue(v)
+				c.Kind, c.Type, c.Value = cursorKindOther, ov.typ, ov.str
+				break
+			}
+			rv := reflect.ValueOf(v)
+			switch {
+			case rv.CanInt():
+				c.Kind, c.Value = cursorKindInt, strconv.FormatInt(rv.Int(), 10)
+			case rv.CanUint():
+				c.Kind, c.Value = cursorKindUint, strconv.FormatUint(rv.Uint(), 10)
+			default:
+				c.Kind, c.Value = cursorKindFloat, strconv.FormatFloat(rv.Float(), 'g', -1, 64)
+			}
+		}
+	}
+	data, _ := json.Marshal(c)
+	return algoutil.Base64RawURLEncode(data)
+}
+
+func decodeCursor(str string, index string) (*position, error) {
+	errInvalid := func(err error) error {
+		e := base.NewErrorWithType(ErrTypeInvalidCursor, ErrInvalidCursor).
+			WithField("cursor", str)
+		if err != nil {
+			e = e.WithMessage(err.Error())
+		}
+		return e
+	}
+	data, err := algoutil.Base64RawURLDecode(str)
+	if err != nil {
+		return nil, errInvalid(err)
+	}
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, errInvalid(err)
+	}
+	if c.Index != index {
+		return nil, errInvalid(fmt.Errorf("cursor is returned by the page ordered by index[%s]", c.Index))
+	}
+	pos := &position{
+		id: c.Id,
+	}
+	if len(index) == 0 {
+		return pos, nil
+	}
+	switch c.Kind {
+	case cursorKindInt:
+		pos.value, err = strconv.ParseInt(c.Value, 10, 64)
+	case cursorKindUint:
+		pos.value, err = strconv.ParseUint(c.Value, 10, 64)
+	case cursorKindFloat:
+		pos.value, err = strconv.ParseFloat(c.Value, 64)
+	case cursorKindString:
+		pos.value = c.Value
+	case cursorKindTime:
+		pos.value, err = time.Parse(time.RFC3339Nano, c.Value)
+	case cursorKindOther:
+		pos.value = otherValue{
+			typ: c.Type,
+			str: c.Value,
+		}
+	default:
+		err = fmt.Errorf("unknown value kind[%s]", c.Kind)
+	}
+	if err != nil {
+		return nil, errInvalid(err)
+	}
+	return pos, nil
+}
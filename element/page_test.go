@@ -0,0 +1,134 @@
+package element
+
+import (
+	"github.com/more-infra/base"
+	"testing"
+)
+
+const indexScore = "item.index.score"
+
+// pageAll iterates all pages and returns the values of items, it joins a new item after each page.
+func pageAll(t *testing.T, mgr *Manager, join func(), options ...PageOption) []int {
+	var (
+		values []int
+		cursor string
+	)
+	for {
+		page, err := mgr.Page(append(options, WithPageSize(3), WithPageCursor(cursor))...)
+		if err != nil {
+			t.Fatalf("Page failed: %v", err)
+		}
+		if len(page.Elements) > 3 {
+			t.Fatalf("Page returns %d elements which are more than page size", len(page.Elements))
+		}
+		for _, e := range page.Elements {
+			values = append(values, e.(*item).value)
+		}
+		if len(page.Next) == 0 {
+			return values
+		}
+		cursor = page.Next
+		if join != nil {
+			join()
+		}
+	}
+}
+
+func assertInts(t *testing.T, name string, actual []int, expected []int) {
+	if len(actual) != len(expected) {
+		t.Fatalf("%s%v is not expected%v", name, actual, expected)
+	}
+	for n := range actual {
+		if actual[n] != expected[n] {
+			t.Fatalf("%s%v is not expected%v", name, actual, expected)
+		}
+	}
+}
+
+func TestPageById(t *testing.T) {
+	mgr := NewManager(WithShards(3))
+	var items []*item
+	for n := 0; n != 10; n++ {
+		items = append(items, newKeyItem(mgr, n))
+	}
+	// join in random order
+	for _, n := range []int{5, 2, 8, 0, 9, 1, 7, 3, 6, 4} {
+		mgr.Join(items[n])
+	}
+	assertInts(t, "values", pageAll(t, mgr, nil), []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9})
+	assertInts(t, "reverse values", pageAll(t, mgr, nil, WithPageReverse()), []int{9, 8, 7, 6, 5, 4, 3, 2, 1, 0})
+
+	// items joined during iterating are after the cursor, and the items left are not returned
+	next := 10
+	join := func() {
+		mgr.Join(newKeyItem(mgr, next))
+		next++
+		items[0].Leave()
+	}
+	assertInts(t, "values", pageAll(t, mgr, join), []int{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13})
+
+	page, err := mgr.Page(WithPageSize(2), WithPageReverse())
+	if err != nil || len(page.Elements) != 2 || page.Elements[0].(*item).value != 13 {
+		t.Fatalf("Page returns unexpected result: %v", err)
+	}
+	if _, err := mgr.Page(WithPageCursor("invalid")); base.ErrorType(err) != ErrTypeInvalidCursor {
+		t.Fatalf("Page returns unexpected error: %v", err)
+	}
+	if _, err := mgr.Page(WithPageOrderBy(indexScore)); base.ErrorType(err) != ErrTypeUnorderedIndex {
+		t.Fatalf("Page returns unexpected error: %v", err)
+	}
+}
+
+func TestPageByIndex(t *testing.T) {
+	mgr := NewManager(WithOrderedIndex(indexScore))
+	scores := map[int][]interface{}{
+		0: {30},
+		1: {int64(10)},
+		2: {2.5, "b"},
+		3: {10},
+		4: {uint(20), "a"},
+		5: {float32(10)},
+		// without score
+		6: nil,
+		7: {-1},
+	}
+	for n := 0; n != len(scores); n++ {
+		itm := newKeyItem(mgr, n)
+		for _, v := range scores[n] {
+			itm.SetIndex(indexScore, v)
+		}
+		mgr.Join(itm)
+	}
+	// numbers are before strings, item 1, 3 and 5 have the same score ordered by id
+	expected := []int{7, 2, 1, 3, 5, 4, 0, 4, 2}
+	assertInts(t, "values", pageAll(t, mgr, nil, WithPageOrderBy(indexScore)), expected)
+	var reversed []int
+	for n := len(expected) - 1; n >= 0; n-- {
+		reversed = append(reversed, expected[n])
+	}
+	assertInts(t, "reverse values", pageAll(t, mgr, nil, WithPageOrderBy(indexScore), WithPageReverse()), reversed)
+
+	// cursor is in the middle of the items with the same score
+	page, err := mgr.Page(WithPageOrderBy(indexScore), WithPageSize(3))
+	if err != nil {
+		t.Fatalf("Page failed: %v", err)
+	}
+	itm := newKeyItem(mgr, 8)
+	itm.SetIndex(indexScore, 10)
+	mgr.Join(itm)
+	mgr.Remove(mgr.Find(keySeq, "3").Meta())
+	page, err = mgr.Page(WithPageOrderBy(indexScore), WithPageCursor(page.Next), WithPageSize(3))
+	if err != nil {
+		t.Fatalf("Page failed: %v", err)
+	}
+	var values []int
+	for _, e := range page.Elements {
+		values = append(values, e.(*item).value)
+	}
+	assertInts(t, "values", values, []int{5, 8, 4})
+
+	// cursor must be used with the same index
+	if _, err := mgr.Page(WithPageCursor(page.Next)); base.ErrorType(err) != ErrTypeInvalidCursor {
+		t.Fatalf("Page returns unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,213 @@
+package element
+
+import (
+	"github.com/more-infra/base/values"
+	"strings"
+)
+
+// WithPrefixIndex builds prefix trees for the string values of the index fields.
+// SearchPattern uses the prefix tree to find the candidate values when the pattern has a literal prefix,
+// such as "%web-*%" or "/^web-.*$/", instead of matching every value of the index.
+// It costs more memory and time when ELEMENTS join or leave, so only set it for the fields searched by pattern frequently.
+func WithPrefixIndex(fields ...string) Option {
+	return func(m *Manager) {
+		for _, f := range fields {
+			m.prefixes[f] = newPrefixTree()
+		}
+	}
+}
+
+// SearchMatch finds the ELEMENTS which has any string value of the index matched by the matcher.
+// Values of the index which are not string type are ignored. It will return empty array(nil) when no ELEMENTS found.
+// The matcher must not be modified during the searching.
+func (m *Manager) SearchMatch(index string, matcher *values.Matcher) []ELEMENT {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	return m.searchMatch(index, matcher)
+}
+
+// SearchPattern finds the ELEMENTS which has any string value of the index matched by the pattern.
+// The pattern syntax is the same as values.Matcher, "/regex/" for regex, "%wild*card%" for wildcard, otherwise it's a string.
+// The options are passed to values.NewMatcher, the match is case-insensitive by default.
+// When the index is defined by WithPrefixIndex and the pattern has a literal prefix, only the values with the prefix will be matched.
+// An error will be returned when the pattern is invalid.
+func (m *Manager) SearchPattern(index string, pattern string, options ...values.Option) ([]ELEMENT, error) {
+	matcher := values.NewMatcher(options...)
+	if err := matcher.Append(pattern); err != nil {
+		return nil, err
+	}
+	prefix, ok := literalPrefix(pattern)
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	tree := m.prefixes[index]
+	if !ok || tree == nil {
+		return m.searchMatch(index, matcher), nil
+	}
+	var matched []string
+	for _, str := range tree.collect(prefix) {
+		if matcher.Match(str) {
+			matched = append(matched, str)
+		}
+	}
+	return m.searchValues(index, matched), nil
+}
+
+// searchMatch matches every string value of the index, the caller must hold the lock of Manager.
+func (m *Manager) searchMatch(index string, matcher *values.Matcher) []ELEMENT {
+	var matched []string
+	for v := range m.indexes[index] {
+		str, ok := v.(string)
+		if ok && matcher.Match(str) {
+			matched = append(matched, str)
+		}
+	}
+	return m.searchValues(index, matched)
+}
+
+// searchValues returns the ELEMENTS of the index values, the caller must hold the lock of Manager.
+func (m *Manager) searchValues(index string, matched []string) []ELEMENT {
+	var els []ELEMENT
+	ref := m.indexes[index]
+	found := make(map[uint64]bool)
+	for _, v := range matched {
+		for id := range ref[v] {
+			if found[id] {
+				continue
+			}
+			found[id] = true
+			e, _ := m.element(id)
+			m.eviction.touch(id)
+			els = append(els, e)
+		}
+	}
+	return els
+}
+
+// literalPrefix returns the literal prefix of the pattern in lower case, it returns false when the pattern has no literal prefix.
+func literalPrefix(pattern string) (string, bool) {
+	var prefix string
+	switch {
+	case len(pattern) > 2 && pattern[0] == '%' && pattern[len(pattern)-1] == '%':
+		body := pattern[1 : len(pattern)-1]
+		if n := strings.IndexAny(body, "*?"); n != -1 {
+			body = body[:n]
+		}
+		prefix = body
+	case len(pattern) > 2 && pattern[0] == '/' && pattern[len(pattern)-1] == '/':
+		body := pattern[1 : len(pattern)-1]
+		if !strings.HasPrefix(body, "^") || strings.Contains(body, "|") {
+			return "", false
+		}
+		body = body[1:]
+		if n := strings.IndexAny(body, `.*+?()[]{}\^$`); n != -1 {
+			// the char before a quantifier is optional
+			if strings.ContainsAny(body[n:n+1], "*?{") && n > 0 {
+				n--
+			}
+			body = body[:n]
+		}
+		prefix = body
+	default:
+		prefix = pattern
+	}
+	if len(prefix) == 0 {
+		return "", false
+	}
+	return strings.ToLower(prefix), true
+}
+
+// prefixTree is a trie of string values in lower case, each node saves the original values which are equal to the path in lower case.
+type prefixTree struct {
+	root *prefixNode
+}
+
+type prefixNode struct {
+	children map[byte]*prefixNode
+	values   map[string]bool
+}
+
+func newPrefixTree() *prefixTree {
+	return &prefixTree{
+		root: &prefixNode{},
+	}
+}
+
+func (t *prefixTree) reset() {
+	t.root = &prefixNode{}
+}
+
+func (t *prefixTree) add(value interface{}) {
+	str, ok := value.(string)
+	if !ok {
+		return
+	}
+	key := strings.ToLower(str)
+	node := t.root
+	for i := 0; i != len(key); i++ {
+		if node.children == nil {
+			node.children = make(map[byte]*prefixNode)
+		}
+		child, ok := node.children[key[i]]
+		if !ok {
+			child = &prefixNode{}
+			node.children[key[i]] = child
+		}
+		node = child
+	}
+	if node.values == nil {
+		node.values = make(map[string]bool)
+	}
+	node.values[str] = true
+}
+
+func (t *prefixTree) remove(value interface{}) {
+	str, ok := value.(string)
+	if !ok {
+		return
+	}
+	key := strings.ToLower(str)
+	path := make([]*prefixNode, 0, len(key)+1)
+	node := t.root
+	path = append(path, node)
+	for i := 0; i != len(key); i++ {
+		child, ok := node.children[key[i]]
+		if !ok {
+			return
+		}
+		node = child
+		path = append(path, node)
+	}
+	delete(node.values, str)
+	// prune the empty nodes from the leaf
+	for i := len(path) - 1; i > 0; i-- {
+		n := path[i]
+		if len(n.values) != 0 || len(n.children) != 0 {
+			break
+		}
+		delete(path[i-1].children, key[i-1])
+	}
+}
+
+// collect returns all original values which start with the prefix in lower case.
+func (t *prefixTree) collect(prefix string) []string {
+	node := t.root
+	for i := 0; i != len(prefix); i++ {
+		child, ok := node.children[prefix[i]]
+		if !ok {
+			return nil
+		}
+		node = child
+	}
+	var result []string
+	var walk func(*prefixNode)
+	walk = func(n *prefixNode) {
+		for v := range n.values {
+			result = append(result, v)
+		}
+		for _, child := range n.children {
+			walk(child)
+		}
+	}
+	walk(node)
+	return result
+}
@@ -0,0 +1,76 @@
+package element
+
+import (
+	"github.com/more-infra/base/values"
+	"testing"
+)
+
+const (
+	indexHost = "item.index.host"
+)
+
+func TestSearchPattern(t *testing.T) {
+	for _, options := range [][]Option{nil, {WithPrefixIndex(indexHost)}} {
+		mgr := NewManager(options...)
+		hosts := []string{"web-01", "Web-02", "web-03.backup", "db-01", "webserver", "cache-web-01"}
+		var items []*item
+		for n, host := range hosts {
+			itm := newKeyItem(mgr, n)
+			itm.SetIndex(indexHost, host)
+			itm.SetIndex(indexHost, n)
+			mgr.Join(itm)
+			items = append(items, itm)
+		}
+		testCases := []struct {
+			pattern  string
+			options  []values.Option
+			expected []int
+		}{
+			{"%web-*%", nil, []int{0, 1, 2}},
+			{"%web-*%", []values.Option{values.WithMatchCaseSensitive(true)}, []int{0, 2}},
+			{"%web-0?%", nil, []int{0, 1}},
+			{"%*-01%", nil, []int{0, 3, 5}},
+			{"/^web-\\d+$/", nil, []int{0, 1}},
+			{"/^(web|db)-01$/", nil, []int{0, 3}},
+			{"webserver", nil, []int{4}},
+			{"%mail-*%", nil, nil},
+		}
+		for _, tc := range testCases {
+			ee, err := mgr.SearchPattern(indexHost, tc.pattern, tc.options...)
+			if err != nil {
+				t.Fatalf("SearchPattern[%s] failed: %v", tc.pattern, err)
+			}
+			assertValues(t, tc.pattern, ee, tc.expected)
+		}
+
+		items[0].Leave()
+		items[1].Leave()
+		ee, _ := mgr.SearchPattern(indexHost, "%web-*%")
+		assertValues(t, "%web-*% after leave", ee, []int{2})
+
+		matcher := values.NewMatcher()
+		_ = matcher.Append("%*-01%")
+		_ = matcher.Append("webserver")
+		assertValues(t, "matcher", mgr.SearchMatch(indexHost, matcher), []int{3, 4, 5})
+	}
+
+	mgr := NewManager()
+	if _, err := mgr.SearchPattern(indexHost, "/^web-(/"); err == nil {
+		t.Fatal("SearchPattern with invalid regex does not return error")
+	}
+}
+
+func assertValues(t *testing.T, name string, ee []ELEMENT, expected []int) {
+	result := make(map[int]bool)
+	for _, e := range ee {
+		result[e.(*item).value] = true
+	}
+	if len(result) != len(ee) || len(result) != len(expected) {
+		t.Fatalf("%s result count[%d] is not expected%v", name, len(ee), expected)
+	}
+	for _, n := range expected {
+		if !result[n] {
+			t.Fatalf("%s result does not contains[%d], expected%v", name, n, expected)
+		}
+	}
+}
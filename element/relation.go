@@ -0,0 +1,271 @@
+package element
+
+import (
+	"github.com/more-infra/base"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// RelationAction defines what to do with the referrers when the ELEMENT referenced leaves its Manager.
+type RelationAction string
+
+func (a RelationAction) String() string {
+	return string(a)
+}
+
+const (
+	// RelationCascade removes the referrers from their Manager when the ELEMENT referenced leaves.
+	RelationCascade RelationAction = "cascade"
+
+	// RelationRestrict rejects the Remove of the ELEMENT referenced while it has any referrer, see Manager.RemoveOrError.
+	// Clear, eviction and cascade removal are not restricted, the references to ELEMENTS left by them are cleared as RelationSetNull.
+	RelationRestrict RelationAction = "restrict"
+
+	// RelationSetNull clears the reference of the referrers when the ELEMENT referenced leaves,
+	// the referrers are still in their Manager, and their versions are increased.
+	RelationSetNull RelationAction = "set_null"
+)
+
+// relation is the references from ELEMENTS of Manager from to ELEMENTS of Manager to.
+// It's shared by the two Managers, refs are protected by its own lock, so it could be operated with either Manager's lock held.
+type relation struct {
+	name   string
+	from   *Manager
+	to     *Manager
+	action RelationAction
+
+	mu sync.Mutex
+
+	// refs are the referrers of each ELEMENT referenced, by the unique autoincrement id of them.
+	refs map[uint64]map[uint64]ELEMENT
+
+	// removing marks the ELEMENTS referenced which are being removed, they could not be referenced by new referrers.
+	removing map[uint64]bool
+}
+
+// WithRelation defines a relation named name, ELEMENTS of the Manager could reference ELEMENTS of the target Manager
+// by Element.SetReference with the name. The target could be the Manager itself when it's nil.
+// When an ELEMENT referenced leaves the target Manager, its referrers are handled by the action, see RelationAction.
+// A referrer could only join when the ELEMENT it references is in the target Manager.
+// Use Referrers for finding the referrers of an ELEMENT.
+func WithRelation(name string, target *Manager, action RelationAction) Option {
+	return func(m *Manager) {
+		r := &relation{
+			name:     name,
+			from:     m,
+			to:       target,
+			action:   action,
+			refs:     make(map[uint64]map[uint64]ELEMENT),
+			removing: make(map[uint64]bool),
+		}
+		m.relations[name] = r
+		if target == nil || target == m {
+			r.to = m
+			m.referenced = append(m.referenced, r)
+			return
+		}
+		target.rw.Lock()
+		target.referenced = append(target.referenced, r)
+		target.rw.Unlock()
+	}
+}
+
+// SetReference makes the Element reference the target ELEMENT by the relation named name defined by WithRelation.
+// It should be called before the Element joins the Manager, and the target must be in the Manager of relation when it joins.
+func (e *Element) SetReference(name string, target ELEMENT) {
+	if e.references == nil {
+		e.references = make(map[string]*Element)
+	}
+	e.references[name] = target.Meta()
+	atomic.AddUint64(&e.version, 1)
+}
+
+// Reference returns the Element referenced by the relation named name, it returns nil when not referenced,
+// or the reference is cleared by RelationSetNull.
+func (e *Element) Reference(name string) *Element {
+	if e.mgr == nil {
+		return e.references[name]
+	}
+	e.mgr.rw.RLock()
+	defer e.mgr.rw.RUnlock()
+	return e.references[name]
+}
+
+// Referrers returns the ELEMENTS in the Manager which reference the target by the relation named name,
+// in the order of their unique autoincrement id.
+func (m *Manager) Referrers(name string, target *Element) []ELEMENT {
+	m.rw.RLock()
+	r, ok := m.relations[name]
+	m.rw.RUnlock()
+	if !ok {
+		return nil
+	}
+	r.mu.Lock()
+	var els []ELEMENT
+	for _, e := range r.refs[target.id] {
+		els = append(els, e)
+	}
+	r.mu.Unlock()
+	sort.Slice(els, func(i, j int) bool {
+		return els[i].Meta().id < els[j].Meta().id
+	})
+	return els
+}
+
+// refer adds the references of the ELEMENT to relations, it returns error when any ELEMENT referenced is not in its Manager.
+// The caller must hold the write lock of Manager.
+func (m *Manager) refer(e ELEMENT) error {
+	meta := e.Meta()
+	var referred []*relation
+	for name, target := range meta.references {
+		r, ok := m.relations[name]
+		if !ok {
+			m.unreferRelations(meta, referred)
+			return base.NewErrorWithType(ErrTypeUnknownRelation, ErrUnknownRelation).
+				WithField("relation", name)
+		}
+		r.mu.Lock()
+		// the target is removed after its in flag cleared, and then its referrers are collected with relation's lock held,
+		// so the reference added here will be collected when the target is in.
+		if target.mgr != r.to || atomic.LoadUint32(&target.in) == 0 || r.removing[target.id] {
+			r.mu.Unlock()
+			m.unreferRelations(meta, referred)
+			return base.NewErrorWithType(ErrTypeReferenceNotFound, ErrReferenceNotFound).
+				WithField("relation", name).
+				WithField("target_id", target.id)
+		}
+		refs, ok := r.refs[target.id]
+		if !ok {
+			refs = make(map[uint64]ELEMENT)
+			r.refs[target.id] = refs
+		}
+		refs[meta.id] = e
+		r.mu.Unlock()
+		referred = append(referred, r)
+	}
+	return nil
+}
+
+// unrefer deletes the references of the Element from relations, the caller must hold the write lock of Manager.
+func (m *Manager) unrefer(meta *Element) {
+	var rr []*relation
+	for name := range meta.references {
+		if r, ok := m.relations[name]; ok {
+			rr = append(rr, r)
+		}
+	}
+	m.unreferRelations(meta, rr)
+}
+
+func (m *Manager) unreferRelations(meta *Element, rr []*relation) {
+	for _, r := range rr {
+		target, ok := meta.references[r.name]
+		if !ok {
+			continue
+		}
+		r.mu.Lock()
+		refs := r.refs[target.id]
+		delete(refs, meta.id)
+		if len(refs) == 0 {
+			delete(r.refs, target.id)
+		}
+		r.mu.Unlock()
+	}
+}
+
+// restrict checks the relations with RelationRestrict before the Element removed, and marks it removing.
+// The caller must hold the write lock of Manager, and call unrestrict when the Element is not removed at last.
+func (m *Manager) restrict(e *Element) error {
+	var marked []*relation
+	for _, r := range m.referenced {
+		if r.action != RelationRestrict {
+			continue
+		}
+		r.mu.Lock()
+		if n := len(r.refs[e.id]); n != 0 {
+			r.mu.Unlock()
+			unrestrict(e, marked)
+			return base.NewErrorWithType(ErrTypeReferenced, ErrReferenced).
+				WithField("relation", r.name).
+				WithField("id", e.id).
+				WithField("referrers", n)
+		}
+		r.removing[e.id] = true
+		r.mu.Unlock()
+		marked = append(marked, r)
+	}
+	return nil
+}
+
+func unrestrict(e *Element, rr []*relation) {
+	for _, r := range rr {
+		r.mu.Lock()
+		delete(r.removing, e.id)
+		r.mu.Unlock()
+	}
+}
+
+// reset deletes all references when the Manager of referrers is cleared, the caller must hold the write lock of the Manager.
+func (r *relation) reset() {
+	r.mu.Lock()
+	r.refs = make(map[uint64]map[uint64]ELEMENT)
+	r.mu.Unlock()
+}
+
+// dereference handles the referrers of the ELEMENTS left by the actions of relations.
+// It must be called without the lock of Manager held.
+func dereference(referenced []*relation, left []*Element) {
+	for _, r := range referenced {
+		var referrers []ELEMENT
+		var targets []*Element
+		r.mu.Lock()
+		for _, meta := range left {
+			delete(r.removing, meta.id)
+			for _, e := range r.refs[meta.id] {
+				referrers = append(referrers, e)
+				targets = append(targets, meta)
+			}
+			delete(r.refs, meta.id)
+		}
+		r.mu.Unlock()
+		for n, e := range referrers {
+			if r.action == RelationCascade {
+				r.from.forceRemove(e.Meta())
+				continue
+			}
+			r.from.clearReference(r, e.Meta(), targets[n])
+		}
+	}
+}
+
+// forceRemove removes the Element without checking the relations with RelationRestrict.
+func (m *Manager) forceRemove(e *Element) {
+	m.lock()
+	ee, ok := m.element(e.id)
+	if ok {
+		m.remove(e)
+		m.batch.record(ChangeRemove, ee)
+	}
+	m.unlock()
+	if ok {
+		m.finalize(e)
+	}
+}
+
+// clearReference clears the reference of the Element to the target by the relation, when it's still in the Manager.
+func (m *Manager) clearReference(r *relation, e *Element, target *Element) {
+	m.lock()
+	if ee, ok := m.element(e.id); ok && e.references[r.name] == target {
+		references := make(map[string]*Element, len(e.references))
+		for name, t := range e.references {
+			if name != r.name {
+				references[name] = t
+			}
+		}
+		e.references = references
+		atomic.AddUint64(&e.version, 1)
+		m.batch.record(ChangeUpdate, ee)
+	}
+	m.unlock()
+}
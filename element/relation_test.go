@@ -0,0 +1,157 @@
+package element
+
+import (
+	"github.com/more-infra/base"
+	"sort"
+	"sync"
+	"testing"
+)
+
+const (
+	relationParent = "item.relation.parent"
+	relationOwner  = "item.relation.owner"
+	relationLink   = "item.relation.link"
+)
+
+func newRefItem(mgr *Manager, value int, refs map[string]ELEMENT) *item {
+	itm := newKeyItem(mgr, value)
+	for name, target := range refs {
+		itm.SetReference(name, target)
+	}
+	return itm
+}
+
+func TestRelation(t *testing.T) {
+	parents := NewManager()
+	children := NewManager(
+		WithRelation(relationParent, parents, RelationCascade),
+		WithRelation(relationOwner, parents, RelationRestrict),
+		WithRelation(relationLink, nil, RelationSetNull),
+	)
+	grandchildren := NewManager(WithRelation(relationParent, children, RelationCascade))
+
+	p1, p2 := newKeyItem(parents, 1), newKeyItem(parents, 2)
+	parents.Join(p1)
+	parents.Join(p2)
+	c1 := newRefItem(children, 11, map[string]ELEMENT{relationParent: p1})
+	c2 := newRefItem(children, 12, map[string]ELEMENT{relationParent: p1, relationOwner: p2})
+	c3 := newRefItem(children, 13, map[string]ELEMENT{relationParent: p2, relationLink: c1})
+	var finalized []int
+	for _, c := range []*item{c1, c2, c3} {
+		c := c
+		c.SetFinalization(func() {
+			finalized = append(finalized, c.value)
+		})
+		if _, err := children.JoinOrError(c); err != nil {
+			t.Fatalf("child[%d] join failed: %v", c.value, err)
+		}
+	}
+	g1 := newRefItem(grandchildren, 21, map[string]ELEMENT{relationParent: c1})
+	grandchildren.Join(g1)
+
+	referrers := children.Referrers(relationParent, p1.Element)
+	if len(referrers) != 2 || referrers[0] != c1 || referrers[1] != c2 {
+		t.Fatalf("Referrers returns unexpected result: %v", referrers)
+	}
+
+	// the owner is referenced by child 12
+	err := p2.LeaveOrError()
+	if base.ErrorType(err) != ErrTypeReferenced || err.(*base.Error).Fields["relation"] != relationOwner {
+		t.Fatalf("LeaveOrError returns unexpected error: %v", err)
+	}
+	if parents.Get(p2.UId()) != p2 {
+		t.Fatal("parent referenced with restrict relation is removed")
+	}
+
+	// child 11, 12 and grandchild 21 are removed by cascade, and the link of child 13 is cleared
+	version := c3.Version()
+	p1.Leave()
+	if children.Count() != 1 || grandchildren.Count() != 0 {
+		t.Fatalf("children[%d] or grandchildren[%d] are not removed by cascade", children.Count(), grandchildren.Count())
+	}
+	sort.Ints(finalized)
+	assertInts(t, "finalized", finalized, []int{11, 12})
+	if c3.Reference(relationLink) != nil || c3.Reference(relationParent) != p2.Element || c3.Version() != version+1 {
+		t.Fatal("reference of child 13 is not cleared by set null")
+	}
+	if err := p2.LeaveOrError(); err != nil {
+		t.Fatalf("LeaveOrError failed: %v", err)
+	}
+	if children.Count() != 0 {
+		t.Fatal("child 13 is not removed by cascade")
+	}
+
+	// the target must be in the Manager of relation
+	c4 := newRefItem(children, 14, map[string]ELEMENT{relationParent: p1})
+	if _, err := children.JoinOrError(c4); base.ErrorType(err) != ErrTypeReferenceNotFound {
+		t.Fatalf("JoinOrError returns unexpected error: %v", err)
+	}
+	c5 := newRefItem(children, 15, map[string]ELEMENT{relationOwner: newKeyItem(children, 99)})
+	if _, err := children.JoinOrError(c5); base.ErrorType(err) != ErrTypeReferenceNotFound {
+		t.Fatalf("JoinOrError returns unexpected error: %v", err)
+	}
+	c6 := newRefItem(children, 16, map[string]ELEMENT{"unknown": p1})
+	if _, err := children.JoinOrError(c6); base.ErrorType(err) != ErrTypeUnknownRelation {
+		t.Fatalf("JoinOrError returns unexpected error: %v", err)
+	}
+	if children.Count() != 0 {
+		t.Fatal("children with invalid reference joined")
+	}
+}
+
+func TestRelationTransaction(t *testing.T) {
+	parents := NewManager()
+	children := NewManager(WithRelation(relationOwner, parents, RelationRestrict))
+	p1 := newKeyItem(parents, 1)
+	parents.Join(p1)
+	c1 := newRefItem(children, 11, map[string]ELEMENT{relationOwner: p1})
+	children.Join(c1)
+
+	tx := parents.Begin()
+	tx.Join(newKeyItem(parents, 2))
+	tx.Remove(p1.Element)
+	if err := tx.Commit(); base.ErrorType(err) != ErrTypeReferenced {
+		t.Fatalf("Commit returns unexpected error: %v", err)
+	}
+	if parents.Count() != 1 {
+		t.Fatal("Tx is not rolled back")
+	}
+
+	// the reference is restored when the Tx rolled back
+	tx = children.Begin()
+	tx.Remove(c1.Element)
+	tx.SetIndex(c1.Element, indexName, "c1")
+	if err := tx.Commit(); base.ErrorType(err) != ErrTypeNotJoined {
+		t.Fatalf("Commit returns unexpected error: %v", err)
+	}
+	if len(children.Referrers(relationOwner, p1.Element)) != 1 {
+		t.Fatal("reference is not restored")
+	}
+	c1.Leave()
+	if err := p1.LeaveOrError(); err != nil {
+		t.Fatalf("LeaveOrError failed: %v", err)
+	}
+}
+
+func TestRelationConcurrently(t *testing.T) {
+	parents := NewManager()
+	children := NewManager(WithRelation(relationParent, parents, RelationCascade))
+	for n := 0; n != 50; n++ {
+		p := newKeyItem(parents, n)
+		parents.Join(p)
+		var wg sync.WaitGroup
+		for i := 0; i != 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				children.Join(newRefItem(children, n*10+i, map[string]ELEMENT{relationParent: p}))
+			}(i)
+		}
+		p.Leave()
+		wg.Wait()
+		// every child is rejected or removed by cascade
+		if children.Count() != 0 || len(children.Referrers(relationParent, p.Element)) != 0 {
+			t.Fatalf("children[%d] of parent[%d] are left", children.Count(), n)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package element
+
+import "sync"
+
+// shard holds a part of the elements in Manager, elements are put into shards by their unique autoincrement id.
+// Reading an element by id only locks the shard it's in, so readers of different shards do not contend with each other.
+// Writing is always done with the Manager's lock held and the shard is locked until the batch ends,
+// so the methods which have held the Manager's lock could read the shards without locking them.
+type shard struct {
+	rw       sync.RWMutex
+	elements map[uint64]ELEMENT
+}
+
+func newShards(n int) []*shard {
+	shards := make([]*shard, n)
+	for i := range shards {
+		shards[i] = &shard{
+			elements: make(map[uint64]ELEMENT),
+		}
+	}
+	return shards
+}
+
+func (s *shard) get(id uint64) (ELEMENT, bool) {
+	s.rw.RLock()
+	e, ok := s.elements[id]
+	s.rw.RUnlock()
+	return e, ok
+}
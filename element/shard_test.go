@@ -0,0 +1,141 @@
+package element
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestShardsAndCopyOnWrite(t *testing.T) {
+	const (
+		num        = 1000
+		goroutines = 8
+	)
+	for _, options := range [][]Option{
+		{WithShards(16)},
+		{WithCopyOnWrite()},
+		{WithShards(16), WithCopyOnWrite()},
+	} {
+		mgr := NewManager(options...)
+		view := mgr.View()
+		var wg sync.WaitGroup
+		for g := 0; g != goroutines; g++ {
+			g := g
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := g; i < num; i += goroutines {
+					itm := &item{
+						Element: mgr.NewElement(),
+						value:   i,
+					}
+					itm.SetKey(keySeq, strconv.Itoa(i))
+					mgr.Join(itm)
+					if mgr.Get(itm.UId()) != itm {
+						t.Errorf("Get[%d] does not return the joined item", itm.UId())
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if view.Len() != 0 {
+			t.Fatalf("View acquired before Join is changed, len[%d]", view.Len())
+		}
+		if mgr.Count() != num {
+			t.Fatalf("Manager.Count()[%d] is not expected[%d]", mgr.Count(), num)
+		}
+		view = mgr.View()
+		if view.Len() != num || len(mgr.Snapshot()) != num {
+			t.Fatalf("View len[%d] or Snapshot len[%d] is not expected[%d]", view.Len(), len(mgr.Snapshot()), num)
+		}
+		for i := 0; i != num/2; i++ {
+			mgr.Find(keySeq, strconv.Itoa(i)).Meta().Leave()
+		}
+		if view.Len() != num {
+			t.Fatalf("View acquired before Remove is changed, len[%d]", view.Len())
+		}
+		var sum int
+		mgr.View().Range(func(e ELEMENT) bool {
+			sum += e.(*item).value
+			return true
+		})
+		expectedSum := (num/2 + num - 1) * (num / 2) / 2
+		if sum != expectedSum {
+			t.Fatalf("sum of View[%d] is not expected[%d]", sum, expectedSum)
+		}
+		mgr.Clear()
+		if !mgr.Empty() || mgr.View().Len() != 0 {
+			t.Fatal("Manager is not empty after Clear() called")
+		}
+	}
+}
+
+func BenchmarkGet(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		options []Option
+	}{
+		{"default", nil},
+		{"shards", []Option{WithShards(32)}},
+		{"cow", []Option{WithCopyOnWrite()}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			mgr, ids := benchmarkManager(bm.options...)
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				var n int
+				for pb.Next() {
+					mgr.Get(ids[n%len(ids)])
+					n++
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkIterate(b *testing.B) {
+	benchmarks := []struct {
+		name    string
+		options []Option
+		iterate func(*Manager)
+	}{
+		{"snapshot", nil, func(mgr *Manager) {
+			for range mgr.Snapshot() {
+			}
+		}},
+		{"cow_view", []Option{WithCopyOnWrite()}, func(mgr *Manager) {
+			mgr.View().Range(func(ELEMENT) bool {
+				return true
+			})
+		}},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			mgr, _ := benchmarkManager(bm.options...)
+			b.SetParallelism(16)
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					bm.iterate(mgr)
+				}
+			})
+		})
+	}
+}
+
+func benchmarkManager(options ...Option) (*Manager, []uint64) {
+	const num = 1024
+	mgr := NewManager(options...)
+	ids := make([]uint64, num)
+	for i := 0; i != num; i++ {
+		itm := &item{
+			Element: mgr.NewElement(),
+			value:   i,
+		}
+		mgr.Join(itm)
+		ids[i] = itm.UId()
+	}
+	return mgr, ids
+}
@@ -0,0 +1,126 @@
+package element
+
+import (
+	"fmt"
+	"sort"
+)
+
+// IndexValueCount is the count of ELEMENTS which have the index value.
+type IndexValueCount struct {
+	Value interface{}
+	Count int
+}
+
+// IndexStats is the statistics of an index in Manager.
+type IndexStats struct {
+	// Values is the count of distinct values of the index.
+	Values int
+
+	// Entries is the total count of ELEMENTS for all values, an ELEMENT is counted for each value it has.
+	Entries int
+}
+
+// Stats is the statistics of Manager, it's used for monitoring.
+type Stats struct {
+	// Elements is the count of ELEMENTS in the Manager.
+	Elements int
+
+	// Capacity is the max count of ELEMENTS set by WithCapacity, 0 means unlimited.
+	Capacity int
+
+	// Weight is the total weight of ELEMENTS calculated by the weigher set by WithWeigher.
+	Weight int64
+
+	// Keys is the count of values for each key field.
+	Keys map[string]int
+
+	// Constraints is the count of composite values for each unique constraint.
+	Constraints map[string]int
+
+	// Indexes is the statistics for each index field.
+	Indexes map[string]IndexStats
+}
+
+// CountByIndex counts the ELEMENTS for each value of the index, it does not need to materialize the ELEMENTS like GroupByIndex.
+// The return map is always no-nil(may an empty map).
+func (m *Manager) CountByIndex(index string) map[interface{}]int {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	counts := make(map[interface{}]int, len(m.indexes[index]))
+	for v, ids := range m.indexes[index] {
+		counts[v] = len(ids)
+	}
+	return counts
+}
+
+// DistinctIndexValues returns all distinct values of the index, the order is not specified.
+func (m *Manager) DistinctIndexValues(index string) []interface{} {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	ref := m.indexes[index]
+	vv := make([]interface{}, 0, len(ref))
+	for v := range ref {
+		vv = append(vv, v)
+	}
+	return vv
+}
+
+// IndexCardinality returns the count of distinct values of the index.
+func (m *Manager) IndexCardinality(index string) int {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	return len(m.indexes[index])
+}
+
+// TopIndexValues returns at most n values of the index which have the most ELEMENTS, in descending order by count.
+// The values with the same count are ordered by their formatted string.
+func (m *Manager) TopIndexValues(index string, n int) []IndexValueCount {
+	counts := m.CountByIndex(index)
+	top := make([]IndexValueCount, 0, len(counts))
+	for v, count := range counts {
+		top = append(top, IndexValueCount{
+			Value: v,
+			Count: count,
+		})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return fmt.Sprint(top[i].Value) < fmt.Sprint(top[j].Value)
+	})
+	if n >= 0 && len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// Stats returns the statistics of the Manager, such as elements count, keys count and index sizes.
+func (m *Manager) Stats() Stats {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	stats := Stats{
+		Elements:    m.Count(),
+		Capacity:    m.eviction.capacity,
+		Weight:      m.eviction.weight,
+		Keys:        make(map[string]int, len(m.keys)),
+		Constraints: make(map[string]int, len(m.constraints)),
+		Indexes:     make(map[string]IndexStats, len(m.indexes)),
+	}
+	for f, ref := range m.keys {
+		stats.Keys[f] = len(ref)
+	}
+	for name, c := range m.constraints {
+		stats.Constraints[name] = len(c.values)
+	}
+	for f, ref := range m.indexes {
+		is := IndexStats{
+			Values: len(ref),
+		}
+		for _, ids := range ref {
+			is.Entries += len(ids)
+		}
+		stats.Indexes[f] = is
+	}
+	return stats
+}
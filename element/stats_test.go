@@ -0,0 +1,59 @@
+package element
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestIndexAggregation(t *testing.T) {
+	mgr := NewManager()
+	// decimal index: 0 has 10 items, 10 has 10 items ... 40 has 10 items, 50 has 5 items
+	// math index: each item has "even" or "odd", items could be divided by 3 has "mt" too.
+	var items []*item
+	for i := 0; i != 55; i++ {
+		itm := newKeyItem(mgr, i)
+		itm.SetIndex(indexDecimal, i/10*10)
+		if i%2 == 0 {
+			itm.SetIndex(indexMath, "even")
+		} else {
+			itm.SetIndex(indexMath, "odd")
+		}
+		if i%3 == 0 {
+			itm.SetIndex(indexMath, "mt")
+		}
+		mgr.Join(itm)
+		items = append(items, itm)
+	}
+	counts := mgr.CountByIndex(indexMath)
+	if counts["even"] != 28 || counts["odd"] != 27 || counts["mt"] != 19 {
+		t.Fatalf("CountByIndex result%v is not expected", counts)
+	}
+	if mgr.IndexCardinality(indexDecimal) != 6 || len(mgr.DistinctIndexValues(indexDecimal)) != 6 {
+		t.Fatalf("cardinality of decimal index[%d] is not expected[%d]", mgr.IndexCardinality(indexDecimal), 6)
+	}
+	top := mgr.TopIndexValues(indexDecimal, 3)
+	if len(top) != 3 || top[0].Value != 0 || top[1].Value != 10 || top[2].Value != 20 || top[0].Count != 10 {
+		t.Fatalf("TopIndexValues result%v is not expected", top)
+	}
+	if top := mgr.TopIndexValues(indexMath, 1); len(top) != 1 || top[0].Value != "even" {
+		t.Fatalf("TopIndexValues result%v is not expected", top)
+	}
+
+	for i := 50; i != 55; i++ {
+		items[i].Leave()
+	}
+	if mgr.IndexCardinality(indexDecimal) != 5 {
+		t.Fatalf("cardinality of decimal index[%d] is not expected[%d] after leave", mgr.IndexCardinality(indexDecimal), 5)
+	}
+
+	stats := mgr.Stats()
+	if stats.Elements != 50 || stats.Keys[keySeq] != 50 {
+		t.Fatalf("Stats%+v is not expected", stats)
+	}
+	if is := stats.Indexes[indexMath]; is.Values != 3 || is.Entries != 50+17 {
+		t.Fatalf("Stats of math index%+v is not expected", is)
+	}
+	if mgr.Find(keySeq, strconv.Itoa(50)) != nil {
+		t.Fatal("key of the left item is found")
+	}
+}
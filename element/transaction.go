@@ -0,0 +1,233 @@
+package element
+
+import (
+	"github.com/more-infra/base"
+	"sync/atomic"
+)
+
+// Tx is an atomic batch of operations on Manager, created by Manager.Begin.
+// The operations are applied in order when Commit called, all of them succeed or none of them is applied.
+// Readers never see the partial changes of a Tx, and Watchers receive all the changes of it in one ChangeSet.
+// Methods of Tx are not thread-safe, a Tx should be used in one goroutine.
+type Tx struct {
+	m    *Manager
+	ops  []txOp
+	done bool
+}
+
+type txOp func(c *txCommit) error
+
+// txCommit records the undo functions and the elements changed during committing.
+type txCommit struct {
+	undo    []func()
+	joined  []*Element
+	removed []*Element
+}
+
+// Begin creates a Tx for the Manager, the operations of the Tx are not applied until Commit called.
+func (m *Manager) Begin() *Tx {
+	return &Tx{
+		m: m,
+	}
+}
+
+// Join inserts the ELEMENT when the Tx is committed, it does nothing when the ELEMENT is in the Manager already.
+// The Tx fails with ErrKeyConflict when any key or unique constraint conflicts,
+// or with ErrCapacityFull when the Manager is full with EvictionReject policy after all operations applied.
+// The initialization of the ELEMENT is started after the Tx committed.
+func (tx *Tx) Join(e ELEMENT) {
+	tx.ops = append(tx.ops, func(c *txCommit) error {
+		m := tx.m
+		meta := e.Meta()
+		if _, ok := m.element(meta.id); ok {
+			return nil
+		}
+		indexes, version := meta.indexes, atomic.LoadUint64(&meta.version)
+		m.compute(e)
+		err := m.refer(e)
+		if err == nil {
+			if _, _, err = m.insert(e, false); err != nil {
+				m.unrefer(meta)
+			}
+		}
+		if err != nil {
+			meta.indexes = indexes
+			atomic.StoreUint64(&meta.version, version)
+			return err
+		}
+		c.joined = append(c.joined, meta)
+		c.undo = append(c.undo, func() {
+			m.remove(meta)
+			meta.indexes = indexes
+			atomic.StoreUint64(&meta.version, version)
+		})
+		return nil
+	})
+}
+
+// Remove deletes the Element when the Tx is committed, it does nothing when the Element is not in the Manager.
+// The Tx fails with ErrReferenced when the Element is referenced by a relation with RelationRestrict.
+// The finalization function of the Element is called after the Tx committed.
+func (tx *Tx) Remove(e *Element) {
+	tx.ops = append(tx.ops, func(c *txCommit) error {
+		m := tx.m
+		ee, ok := m.element(e.id)
+		if !ok {
+			return nil
+		}
+		if err := m.restrict(e); err != nil {
+			return err
+		}
+		m.remove(e)
+		m.batch.record(ChangeRemove, ee)
+		c.removed = append(c.removed, e)
+		c.undo = append(c.undo, func() {
+			m.restore(ee)
+			_ = m.refer(ee)
+			unrestrict(e, m.referenced)
+		})
+		return nil
+	})
+}
+
+// SetKey replaces all values of the key field of the Element when the Tx is committed, the field is deleted when no values given.
+// The Element must be in the Manager or joined by the Tx before, otherwise the Tx fails with ErrNotJoined.
+// The Tx fails with ErrKeyConflict when any new value conflicts with other ELEMENTS.
+func (tx *Tx) SetKey(e *Element, field string, values ...interface{}) {
+	tx.ops = append(tx.ops, func(c *txCommit) error {
+		return tx.m.replace(c, e, replaceField(e.keys, field, values), e.indexes)
+	})
+}
+
+// SetIndex replaces all values of the index field of the Element when the Tx is committed, the field is deleted when no values given.
+// The Element must be in the Manager or joined by the Tx before, otherwise the Tx fails with ErrNotJoined.
+// The Tx fails with ErrKeyConflict when the new values conflict with any unique constraint.
+func (tx *Tx) SetIndex(e *Element, field string, values ...interface{}) {
+	tx.ops = append(tx.ops, func(c *txCommit) error {
+		return tx.m.replace(c, e, e.keys, replaceField(e.indexes, field, values))
+	})
+}
+
+// Refresh evaluates the computed indexes defined by WithComputedIndex for the Element when the Tx is committed,
+// and updates the index values which are changed. See Manager.Refresh for more details.
+func (tx *Tx) Refresh(e *Element) {
+	tx.ops = append(tx.ops, func(c *txCommit) error {
+		return tx.m.refresh(c, e)
+	})
+}
+
+// Commit applies all operations of the Tx atomically, the Tx could not be used after Commit.
+// When any operation fails, all operations applied are rolled back and the error is returned.
+// ELEMENTS evicted for the capacity are finalized after the Tx committed, as Join does.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return base.NewErrorWithType(ErrTypeTxDone, ErrTxDone)
+	}
+	tx.done = true
+	m := tx.m
+	c := &txCommit{}
+	m.lock()
+	// the evictor is restored by its journal when rolled back, so the usage of ELEMENTS is kept
+	m.eviction.begin()
+	var err error
+	// ops may be appended during committing, see CompareAndSwap
+	for n := 0; n != len(tx.ops); n++ {
+		if err = tx.ops[n](c); err != nil {
+			break
+		}
+	}
+	var evicted []ELEMENT
+	if err == nil && len(c.joined) != 0 {
+		var ok bool
+		evicted, ok = m.shrink(0, 0)
+		if !ok {
+			err = base.NewErrorWithType(ErrTypeCapacityFull, ErrCapacityFull).
+				WithField("capacity", m.eviction.capacity).
+				WithField("max_weight", m.eviction.maxWeight)
+		}
+	}
+	if err != nil {
+		m.eviction.rollback()
+		for _, e := range evicted {
+			m.restore(e)
+			_ = m.refer(e)
+		}
+		for n := len(c.undo) - 1; n >= 0; n-- {
+			c.undo[n]()
+		}
+		m.batch.changes = nil
+		m.unlock()
+		return err
+	}
+	m.eviction.commit()
+	m.unlock()
+	// the initializations of ELEMENTS left are canceled before starting the initializations of ELEMENTS joined,
+	// so an ELEMENT joined and then left in the Tx finishes its initialization immediately.
+	for _, meta := range c.removed {
+		cancelInitialization(meta)
+	}
+	for _, e := range evicted {
+		cancelInitialization(e.Meta())
+	}
+	for _, meta := range c.joined {
+		m.startInitialization(meta)
+	}
+	for _, meta := range c.removed {
+		m.finalize(meta)
+	}
+	m.evicted(evicted)
+	return nil
+}
+
+// Rollback discards all operations of the Tx, the Tx could not be used after Rollback.
+func (tx *Tx) Rollback() {
+	tx.done = true
+	tx.ops = nil
+}
+
+// replace updates the keys and indexes of the Element in Manager, the caller must hold the write lock of Manager.
+func (m *Manager) replace(c *txCommit, e *Element, keys map[string][]interface{}, indexes map[string][]interface{}) error {
+	ee, ok := m.element(e.id)
+	if !ok {
+		return m.errNotJoined(e)
+	}
+	oldKeys, oldIndexes := e.keys, e.indexes
+	m.unlink(e)
+	e.keys, e.indexes = keys, indexes
+	composites := m.composites(e)
+	if _, err := m.conflict(e.id, keys, composites); err != nil {
+		e.keys, e.indexes = oldKeys, oldIndexes
+		m.link(e, m.composites(e))
+		return err
+	}
+	m.link(e, composites)
+	atomic.AddUint64(&e.version, 1)
+	m.batch.record(ChangeUpdate, ee)
+	c.undo = append(c.undo, func() {
+		atomic.AddUint64(&e.version, ^uint64(0))
+		m.unlink(e)
+		e.keys, e.indexes = oldKeys, oldIndexes
+		m.link(e, m.composites(e))
+	})
+	return nil
+}
+
+// replaceField returns a copy of fields with the values of field replaced.
+func replaceField(fields map[string][]interface{}, field string, values []interface{}) map[string][]interface{} {
+	replaced := make(map[string][]interface{}, len(fields)+1)
+	for f, vv := range fields {
+		replaced[f] = vv
+	}
+	if len(values) == 0 {
+		delete(replaced, field)
+	} else {
+		replaced[field] = append([]interface{}(nil), values...)
+	}
+	return replaced
+}
+
+func cancelInitialization(meta *Element) {
+	if meta.initial != nil {
+		meta.initial.cancel()
+	}
+}
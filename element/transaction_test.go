@@ -0,0 +1,221 @@
+package element
+
+import (
+	"github.com/more-infra/base"
+	"github.com/more-infra/base/queue"
+	"testing"
+	"time"
+)
+
+func TestTransaction(t *testing.T) {
+	mgr := NewManager(WithCopyOnWrite(), WithShards(4))
+	w := mgr.Watch()
+	defer w.Close()
+
+	itm1 := newKeyItem(mgr, 1)
+	itm2 := newKeyItem(mgr, 2)
+	mgr.Join(itm1)
+	var finalized bool
+	itm1.SetFinalization(func() {
+		finalized = true
+	})
+
+	tx := mgr.Begin()
+	tx.Join(itm2)
+	tx.SetIndex(itm2.Element, indexTenant, "t1", "t2")
+	tx.SetKey(itm2.Element, keyUniqueValue, "two")
+	tx.Remove(itm1.Element)
+	// nothing is applied before Commit
+	if mgr.Count() != 1 || mgr.Get(itm2.UId()) != nil {
+		t.Fatal("operations of Tx are applied before Commit")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if mgr.Count() != 1 || mgr.View().Len() != 1 || mgr.Get(itm1.UId()) != nil || !finalized {
+		t.Fatal("item 1 is not removed by Tx")
+	}
+	if mgr.Find(keyUniqueValue, "two") != itm2 || len(mgr.Search(indexTenant, "t2")) != 1 {
+		t.Fatal("keys or indexes of item 2 are not set by Tx")
+	}
+	if err := tx.Commit(); base.ErrorType(err) != ErrTypeTxDone {
+		t.Fatalf("Commit twice returns unexpected error: %v", err)
+	}
+
+	// the first ChangeSet is the Join, the second is the Tx
+	var css []*ChangeSet
+	for len(css) != 2 {
+		select {
+		case cs := <-w.Channel():
+			css = append(css, cs)
+		case <-time.After(time.Second):
+			t.Fatalf("ChangeSet is not received, received %d", len(css))
+		}
+	}
+	expected := []ChangeOp{ChangeJoin, ChangeUpdate, ChangeUpdate, ChangeRemove}
+	if css[1].Seq != css[0].Seq+1 || len(css[1].Changes) != len(expected) {
+		t.Fatalf("ChangeSet[%d] of Tx has unexpected changes: %v", css[1].Seq, css[1].Changes)
+	}
+	for n, c := range css[1].Changes {
+		if c.Op != expected[n] {
+			t.Fatalf("change[%d] op[%s] is not expected[%s]", n, c.Op, expected[n])
+		}
+	}
+}
+
+func TestTransactionRollback(t *testing.T) {
+	mgr := NewManager(WithUniqueConstraint(constraintTenantName, indexTenant, indexName), WithCapacity(3))
+	w := mgr.Watch()
+	itm1 := newKeyItem(mgr, 1)
+	itm1.SetIndex(indexTenant, "t1")
+	itm1.SetIndex(indexName, "web")
+	mgr.Join(itm1)
+	<-w.Channel()
+
+	itm2 := newKeyItem(mgr, 2)
+	itm2.SetIndex(indexTenant, "t1")
+	tx := mgr.Begin()
+	tx.Join(itm2)
+	tx.Remove(itm1.Element)
+	tx.SetIndex(itm1.Element, indexName, "db")
+	err := tx.Commit()
+	if base.ErrorType(err) != ErrTypeNotJoined {
+		t.Fatalf("Commit returns unexpected error: %v", err)
+	}
+	if mgr.Count() != 1 || mgr.Get(itm2.UId()) != nil || mgr.Find(keySeq, "1") != itm1 {
+		t.Fatal("Tx is not rolled back")
+	}
+	if mgr.FindComposite(constraintTenantName, "t1", "web") != itm1 {
+		t.Fatal("unique constraint of item 1 is not restored")
+	}
+
+	// the second name conflicts with item 1
+	tx = mgr.Begin()
+	tx.Join(itm2)
+	tx.SetIndex(itm2.Element, indexName, "db", "web")
+	if err := tx.Commit(); base.ErrorType(err) != ErrTypeKeyConflict {
+		t.Fatalf("Commit returns unexpected error: %v", err)
+	}
+	if mgr.Count() != 1 || len(mgr.Search(indexName, "db")) != 0 {
+		t.Fatal("Tx is not rolled back")
+	}
+
+	// the capacity is checked after all operations applied
+	tx = mgr.Begin()
+	for n := 2; n != 5; n++ {
+		tx.Join(newKeyItem(mgr, n))
+	}
+	if err := tx.Commit(); base.ErrorType(err) != ErrTypeCapacityFull {
+		t.Fatalf("Commit returns unexpected error: %v", err)
+	}
+	tx = mgr.Begin()
+	for n := 2; n != 5; n++ {
+		tx.Join(newKeyItem(mgr, n))
+	}
+	tx.Remove(itm1.Element)
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	if mgr.Count() != 3 {
+		t.Fatalf("Count[%d] is not expected", mgr.Count())
+	}
+
+	tx = mgr.Begin()
+	tx.Join(newKeyItem(mgr, 5))
+	tx.Rollback()
+	if err := tx.Commit(); base.ErrorType(err) != ErrTypeTxDone {
+		t.Fatalf("Commit after Rollback returns unexpected error: %v", err)
+	}
+
+	// rolled back Tx publishes nothing
+	select {
+	case cs := <-w.Channel():
+		if len(cs.Changes) != 4 {
+			t.Fatalf("ChangeSet[%d] has unexpected changes: %v", cs.Seq, cs.Changes)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("ChangeSet is not received")
+	}
+	if css := w.Close(); len(css) != 0 {
+		t.Fatalf("unexpected ChangeSet %v", css)
+	}
+}
+
+func TestTransactionRollbackEviction(t *testing.T) {
+	testCases := []struct {
+		policy  EvictionPolicy
+		touch   func(mgr *Manager)
+		removed []int
+		joined  []int
+		evicted []int
+	}{
+		{
+			policy:  EvictionLRU,
+			touch:   func(mgr *Manager) { mgr.Find(keySeq, "1") },
+			removed: []int{1, 2},
+			joined:  []int{4, 5},
+			evicted: []int{2, 3},
+		},
+		{
+			policy: EvictionLFU,
+			touch: func(mgr *Manager) {
+				mgr.Find(keySeq, "1")
+				mgr.Find(keySeq, "1")
+				mgr.Find(keySeq, "2")
+			},
+			removed: []int{1, 3},
+			joined:  []int{4, 5},
+			evicted: []int{3, 4},
+		},
+	}
+	for _, tc := range testCases {
+		var evicted []int
+		mgr := NewManager(
+			WithCapacity(3),
+			WithEvictionPolicy(tc.policy),
+			WithEvictionCallback(func(e ELEMENT) {
+				evicted = append(evicted, e.(*item).value)
+			}))
+		items := make(map[int]*item)
+		for i := 1; i != 4; i++ {
+			items[i] = newKeyItem(mgr, i)
+			mgr.Join(items[i])
+		}
+		tc.touch(mgr)
+		w := mgr.Watch()
+		tx := mgr.Begin()
+		for _, v := range tc.removed {
+			tx.Remove(items[v].Element)
+		}
+		tx.Join(newKeyItem(mgr, 9))
+		tx.SetIndex(newKeyItem(mgr, 10).Element, indexName, "web")
+		if err := tx.Commit(); base.ErrorType(err) != ErrTypeNotJoined {
+			t.Fatalf("policy[%s] Commit returns unexpected error: %v", tc.policy, err)
+		}
+		// the usage of ELEMENTS removed is restored as before the Tx
+		for _, v := range tc.joined {
+			mgr.Join(newKeyItem(mgr, v))
+		}
+		assertInts(t, string(tc.policy)+" evicted", evicted, tc.evicted)
+		// the rolled back Tx publishes nothing, the first ChangeSet is the Join after it
+		cs := <-w.Channel()
+		var joined []int
+		for _, c := range cs.Changes {
+			if c.Op == ChangeJoin {
+				joined = append(joined, c.Element.(*item).value)
+			}
+		}
+		assertInts(t, string(tc.policy)+" joined", joined, tc.joined[:1])
+		w.Close()
+	}
+}
+
+func TestWatchPolicyBlock(t *testing.T) {
+	mgr := NewManager()
+	defer func() {
+		if recover() == nil {
+			t.Fatal("watch with block policy does not panic")
+		}
+	}()
+	mgr.Watch(queue.WithQueuePolicy(queue.PolicyBlock))
+}
@@ -0,0 +1,99 @@
+package element
+
+import (
+	"github.com/more-infra/base"
+	"sync/atomic"
+)
+
+// Versioned is an ELEMENT with its version read at the same time, see FindVersioned and SearchVersioned.
+type Versioned struct {
+	Element ELEMENT
+	Version uint64
+}
+
+// FindVersioned is the same as Find, but it returns the version of the ELEMENT read with the ELEMENT atomically.
+// The version could be passed to CompareAndSwap for updating the ELEMENT optimistically.
+// It returns nil and 0 when the ELEMENT not found.
+func (m *Manager) FindVersioned(unique string, value interface{}) (ELEMENT, uint64) {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	e := m.find(unique, value)
+	if e == nil {
+		return nil, 0
+	}
+	return e, e.Meta().Version()
+}
+
+// SearchVersioned is the same as Search, but it returns the versions of the ELEMENTS read with the ELEMENTS atomically.
+func (m *Manager) SearchVersioned(index string, value interface{}) []Versioned {
+	m.rw.RLock()
+	defer m.rw.RUnlock()
+	var vv []Versioned
+	for _, e := range m.search(index, value) {
+		vv = append(vv, Versioned{
+			Element: e,
+			Version: e.Meta().Version(),
+		})
+	}
+	return vv
+}
+
+// CompareVersion makes the Tx fail with ErrVersionConflict typed ErrTypeVersionConflict when the version of the Element
+// is not equal to the version when this operation is applied. The error has fields "id", "expected" and "actual".
+// The Element must be in the Manager or joined by the Tx before, otherwise the Tx fails with ErrNotJoined.
+func (tx *Tx) CompareVersion(e *Element, version uint64) {
+	tx.ops = append(tx.ops, func(c *txCommit) error {
+		return tx.m.compareVersion(e, version)
+	})
+}
+
+// CompareAndSwap updates the Element when its version is equal to the version, otherwise it fails with ErrVersionConflict.
+// The function f is called with the Manager's write lock held after the version checked, so the payload of the Element
+// could be updated safely in it, and the keys and indexes could be updated by the Tx in it. Do not call methods of Manager in f.
+// When f returns an error, the operations of the Tx are rolled back, but the payload updated by f should be restored by itself.
+// The version is increased by one when f does not change the keys or indexes of the Element,
+// and the new version is returned when succeeded.
+func (m *Manager) CompareAndSwap(e *Element, version uint64, f func(tx *Tx) error) (uint64, error) {
+	tx := m.Begin()
+	var swapped uint64
+	tx.ops = append(tx.ops, func(c *txCommit) error {
+		if err := m.compareVersion(e, version); err != nil {
+			return err
+		}
+		if f != nil {
+			if err := f(tx); err != nil {
+				return err
+			}
+		}
+		// the operations appended by f are applied before this one
+		tx.ops = append(tx.ops, func(c *txCommit) error {
+			if atomic.LoadUint64(&e.version) == version {
+				atomic.AddUint64(&e.version, 1)
+				c.undo = append(c.undo, func() {
+					atomic.AddUint64(&e.version, ^uint64(0))
+				})
+			}
+			swapped = atomic.LoadUint64(&e.version)
+			return nil
+		})
+		return nil
+	})
+	if err := tx.Commit(); err != nil {
+		return 0, err
+	}
+	return swapped, nil
+}
+
+// compareVersion checks the version of the Element in Manager, the caller must hold the lock of Manager.
+func (m *Manager) compareVersion(e *Element, version uint64) error {
+	if _, ok := m.element(e.id); !ok {
+		return m.errNotJoined(e)
+	}
+	if actual := atomic.LoadUint64(&e.version); actual != version {
+		return base.NewErrorWithType(ErrTypeVersionConflict, ErrVersionConflict).
+			WithField("id", e.id).
+			WithField("expected", version).
+			WithField("actual", actual)
+	}
+	return nil
+}
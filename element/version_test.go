@@ -0,0 +1,106 @@
+package element
+
+import (
+	"github.com/more-infra/base"
+	"sync"
+	"testing"
+)
+
+func TestVersion(t *testing.T) {
+	mgr := NewManager()
+	itm := newKeyItem(mgr, 1)
+	itm.SetIndex(indexTenant, "t1")
+	if itm.Version() != 2 {
+		t.Fatalf("version[%d] is not increased by SetKey and SetIndex", itm.Version())
+	}
+	mgr.Join(itm)
+
+	tx := mgr.Begin()
+	tx.SetIndex(itm.Element, indexTenant, "t2")
+	if err := tx.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+	e, version := mgr.FindVersioned(keySeq, "1")
+	if e != itm || version != 3 {
+		t.Fatalf("FindVersioned returns unexpected version[%d]", version)
+	}
+	vv := mgr.SearchVersioned(indexTenant, "t2")
+	if len(vv) != 1 || vv[0].Element != itm || vv[0].Version != 3 {
+		t.Fatalf("SearchVersioned returns unexpected result: %v", vv)
+	}
+
+	// the version is rolled back with the Tx
+	tx = mgr.Begin()
+	tx.SetIndex(itm.Element, indexTenant, "t3")
+	tx.CompareVersion(itm.Element, 3)
+	err := tx.Commit()
+	if base.ErrorType(err) != ErrTypeVersionConflict || base.OriginalError(err) != ErrVersionConflict {
+		t.Fatalf("Commit returns unexpected error: %v", err)
+	}
+	fields := err.(*base.Error).Fields
+	if fields["expected"] != "3" || fields["actual"] != "4" {
+		t.Fatalf("version conflict error fields%v are not expected", fields)
+	}
+	if itm.Version() != 3 || len(mgr.Search(indexTenant, "t2")) != 1 {
+		t.Fatal("Tx is not rolled back")
+	}
+
+	// the version is increased once when keys or indexes are changed by CompareAndSwap
+	version, err = mgr.CompareAndSwap(itm.Element, 3, func(tx *Tx) error {
+		tx.SetIndex(itm.Element, indexName, "web")
+		return nil
+	})
+	if err != nil || version != 4 || len(mgr.Search(indexName, "web")) != 1 {
+		t.Fatalf("CompareAndSwap returns unexpected version[%d]: %v", version, err)
+	}
+	if _, err := mgr.CompareAndSwap(itm.Element, 3, nil); base.ErrorType(err) != ErrTypeVersionConflict {
+		t.Fatalf("CompareAndSwap returns unexpected error: %v", err)
+	}
+	mgr.Remove(itm.Element)
+	if _, err := mgr.CompareAndSwap(itm.Element, 4, nil); base.ErrorType(err) != ErrTypeNotJoined {
+		t.Fatalf("CompareAndSwap returns unexpected error: %v", err)
+	}
+}
+
+func TestCompareAndSwapConcurrently(t *testing.T) {
+	mgr := NewManager()
+	itm := newKeyItem(mgr, 0)
+	mgr.Join(itm)
+	const (
+		workers = 8
+		times   = 100
+	)
+	var (
+		wg        sync.WaitGroup
+		conflicts int64
+		mu        sync.Mutex
+	)
+	for n := 0; n != workers; n++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i != times; {
+				e, version := mgr.FindVersioned(keySeq, "0")
+				_, err := mgr.CompareAndSwap(e.Meta(), version, func(tx *Tx) error {
+					itm.value++
+					return nil
+				})
+				if err == nil {
+					i++
+					continue
+				}
+				if base.ErrorType(err) != ErrTypeVersionConflict {
+					t.Errorf("CompareAndSwap returns unexpected error: %v", err)
+					return
+				}
+				mu.Lock()
+				conflicts++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if itm.value != workers*times || itm.Version() != 1+workers*times {
+		t.Fatalf("value[%d] or version[%d] is not expected, conflicts[%d]", itm.value, itm.Version(), conflicts)
+	}
+}
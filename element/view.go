@@ -0,0 +1,33 @@
+package element
+
+// View is an immutable view of the elements in Manager at some point.
+// When the Manager is created with WithCopyOnWrite, the View is shared by all readers and costs nothing to acquire,
+// otherwise it's a copy of the elements like Snapshot does.
+// The View will not be changed by later operations of Manager, so it could be iterated without any lock.
+type View struct {
+	elements map[uint64]ELEMENT
+}
+
+var emptyView = &View{
+	elements: make(map[uint64]ELEMENT),
+}
+
+// Get finds the element by unique autoincrement id in the View, it returns nil when not found.
+func (v *View) Get(id uint64) ELEMENT {
+	return v.elements[id]
+}
+
+// Len returns the count of elements in the View.
+func (v *View) Len() int {
+	return len(v.elements)
+}
+
+// Range calls f for each element in the View, the iterating will stop when f returns false.
+// The order of iterating is not specified.
+func (v *View) Range(f func(ELEMENT) bool) {
+	for _, e := range v.elements {
+		if !f(e) {
+			return
+		}
+	}
+}
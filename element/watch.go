@@ -0,0 +1,100 @@
+package element
+
+import (
+	"github.com/more-infra/base/queue"
+)
+
+type ChangeOp string
+
+func (op ChangeOp) String() string {
+	return string(op)
+}
+
+const (
+	// ChangeJoin means the ELEMENT joined the Manager.
+	ChangeJoin ChangeOp = "join"
+
+	// ChangeRemove means the ELEMENT is removed from the Manager by Remove or Leave.
+	ChangeRemove ChangeOp = "remove"
+
+	// ChangeEvict means the ELEMENT is evicted by the Manager when it's full.
+	ChangeEvict ChangeOp = "evict"
+
+	// ChangeUpdate means the keys or indexes of the ELEMENT are updated.
+	ChangeUpdate ChangeOp = "update"
+
+	// ChangeClear means all ELEMENTS are cleared by Clear, the Element of the Change is nil.
+	ChangeClear ChangeOp = "clear"
+)
+
+// Change is one change of the ELEMENT in Manager.
+type Change struct {
+	Op      ChangeOp
+	Element ELEMENT
+}
+
+// ChangeSet is the changes committed by Manager at once, such as Join, Remove or Tx.Commit.
+// A Join may have several changes as it evicts ELEMENTS, and a Tx has all the changes of it in one ChangeSet.
+type ChangeSet struct {
+	// Seq is the sequence of the commit in Manager, it's increased by one for each ChangeSet.
+	Seq uint64
+
+	// Changes are in the order of they happened.
+	Changes []Change
+}
+
+// Watcher receives the ChangeSet committed by Manager in order.
+// Call Close when it's not used, or the ChangeSet will be buffered continuously.
+type Watcher struct {
+	m      *Manager
+	buffer *queue.Buffer[*ChangeSet]
+}
+
+// Watch creates a Watcher receiving the ChangeSet committed after it's created.
+// The options define the queue.Buffer of the Watcher, the ChangeSet will be dropped by the queue policy when it's full.
+// The ChangeSet is pushed with the lock of Manager held, so queue.PolicyBlock is not allowed, it panics.
+func (m *Manager) Watch(options ...queue.BufferOption) *Watcher {
+	w := &Watcher{
+		m:      m,
+		buffer: queue.NewBufferOf[*ChangeSet](options...),
+	}
+	if w.buffer.Policy() == queue.PolicyBlock {
+		w.buffer.Dispose()
+		panic("element manager watcher could not use the queue block policy")
+	}
+	m.rw.Lock()
+	m.watchers[w] = true
+	m.rw.Unlock()
+	return w
+}
+
+// Channel returns the chan for receiving ChangeSet, the chan will be closed after Close is called.
+func (w *Watcher) Channel() <-chan *ChangeSet {
+	return w.buffer.Channel()
+}
+
+// Close stops the Watcher receiving ChangeSet, and returns the ChangeSet which are not received.
+func (w *Watcher) Close() []*ChangeSet {
+	w.m.rw.Lock()
+	delete(w.m.watchers, w)
+	w.m.rw.Unlock()
+	return w.buffer.Dispose()
+}
+
+// publish pushes the changes to watchers as a ChangeSet, the caller must hold the write lock of Manager.
+func (m *Manager) publish(changes []Change) {
+	if len(changes) == 0 {
+		return
+	}
+	m.seq++
+	if len(m.watchers) == 0 {
+		return
+	}
+	cs := &ChangeSet{
+		Seq:     m.seq,
+		Changes: changes,
+	}
+	for w := range m.watchers {
+		w.buffer.Push(cs)
+	}
+}
@@ -1,6 +1,7 @@
 package observer
 
 import (
+	"context"
 	"github.com/more-infra/base/element"
 	"github.com/more-infra/base/event"
 	"github.com/more-infra/base/queue"
@@ -30,6 +31,7 @@ func WithObserverOption(options ...ObserverOption) Option {
 }
 
 // WithQueueBufferOption is the option for the queue buffer in Observers of the Manager.
+// With queue.PolicyBlock, Push waits for the Observer which queue is full, until it's closed or the Manager is disposed.
 func WithQueueBufferOption(options ...queue.BufferOption) Option {
 	return func(m *Manager) {
 		m.queueOptions = append(m.queueOptions, options...)
@@ -54,7 +56,7 @@ func WithNotifyChannelCapacity(capacity int) ObserverOption {
 // Then use Add to add observers to the manager.
 func NewManager(options ...Option) *Manager {
 	mgr := &Manager{
-		observers: element.NewManager(),
+		observers: element.NewManager(element.WithCopyOnWrite()),
 	}
 	for _, op := range options {
 		op(mgr)
@@ -73,37 +75,40 @@ func (m *Manager) Add() *Observer {
 // Push pushes the event to all observers in the manager.
 // Every Observer use chan returned by Notify() to receive the event.
 func (m *Manager) Push(evt *event.Event) {
-	snapShot := m.observers.Snapshot()
-	for _, e := range snapShot {
+	m.observers.View().Range(func(e element.ELEMENT) bool {
 		ob := e.(*Observer)
 		ob.push(evt)
-	}
+		return true
+	})
 }
 
 // Dispose disposes the manager and the observers.
 // Call it when you don't need the manager anymore.
 func (m *Manager) Dispose() {
 	var wg sync.WaitGroup
-	snapShot := m.observers.Snapshot()
-	for _, e := range snapShot {
+	m.observers.View().Range(func(e element.ELEMENT) bool {
 		ob := e.(*Observer)
 		wg.Add(1)
 		go func() {
 			ob.dispose()
 			wg.Done()
 		}()
-	}
+		return true
+	})
 	wg.Wait()
 }
 
 func (m *Manager) newObserver() *Observer {
+	c, cancel := context.WithCancel(context.Background())
 	ob := &Observer{
+		c:                c,
+		cancel:           cancel,
 		element:          m.observers.NewElement(),
 		runner:           runner.NewRunner(),
 		statusController: status.NewController(),
 		disposedCh:       make(chan struct{}),
 		notifyCh:         make(chan *event.Event),
-		eventQueue:       queue.NewBuffer(m.queueOptions...),
+		eventQueue:       queue.NewBufferOf[*event.Event](m.queueOptions...),
 	}
 	for _, op := range m.observerOptions {
 		op(ob)
@@ -116,10 +121,12 @@ type Observer struct {
 	element          *element.Element
 	runner           *runner.Runner
 	statusController *status.Controller
-	eventQueue       *queue.Buffer
+	eventQueue       *queue.Buffer[*event.Event]
 	notifyCh         chan *event.Event
 	disposedCh       chan struct{}
 	disposed         int64
+	c                context.Context
+	cancel           context.CancelFunc
 }
 
 // Notify returns a channel to receive the event from the manager.
@@ -154,6 +161,8 @@ func (ob *Observer) startup() {
 }
 
 func (ob *Observer) shutdown() {
+	// cancel the pushing blocked by the queue, or stopping will wait for it
+	ob.cancel()
 	if !ob.statusController.Stopping() {
 		return
 	}
@@ -167,6 +176,7 @@ func (ob *Observer) shutdown() {
 
 func (ob *Observer) dispose() {
 	if atomic.CompareAndSwapInt64(&ob.disposed, 0, 1) {
+		ob.cancel()
 		close(ob.disposedCh)
 	}
 }
@@ -175,8 +185,8 @@ func (ob *Observer) push(evt *event.Event) {
 	if !ob.statusController.KeepRunning() {
 		return
 	}
-	ob.eventQueue.Push(evt)
-	ob.statusController.ReleaseRunning()
+	defer ob.statusController.ReleaseRunning()
+	ob.eventQueue.PushWithContext(ob.c, evt)
 }
 
 func (ob *Observer) running() {
@@ -185,11 +195,10 @@ func (ob *Observer) running() {
 		select {
 		case <-ob.runner.Quit():
 			return
-		case v, ok := <-ob.eventQueue.Channel():
+		case evt, ok := <-ob.eventQueue.Channel():
 			if !ok {
 				return
 			}
-			evt := v.(*event.Event)
 			select {
 			case <-ob.runner.Quit():
 				return
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/more-infra/base/event"
 	"github.com/more-infra/base/queue"
@@ -42,3 +43,37 @@ func TestObserver(t *testing.T) {
 		t.Fatalf("received %d, expected 1024", received)
 	}
 }
+
+func TestObserverBlock(t *testing.T) {
+	const num = 1024
+	mgr := NewManager(
+		WithQueueBufferOption(queue.WithChannelCapacity(1), queue.WithQueueCapacity(16), queue.WithQueuePolicy(queue.PolicyBlock)),
+	)
+	defer mgr.Dispose()
+	ob := mgr.Add()
+	pushed := make(chan struct{})
+	go func() {
+		for i := 0; i < num; i++ {
+			mgr.Push(event.NewEvent(strconv.Itoa(i)))
+		}
+		close(pushed)
+	}()
+	for i := 0; i < num; i++ {
+		evt := <-ob.Notify()
+		if evt.Category() != strconv.Itoa(i) {
+			t.Fatalf("category %s, expected %d", evt.Category(), i)
+		}
+	}
+	<-pushed
+
+	// Close is not blocked by the pushing which waits for the full queue
+	go func() {
+		for i := 0; i < num; i++ {
+			mgr.Push(event.NewEvent(strconv.Itoa(i)))
+		}
+	}()
+	for ob.eventQueue.Size() < 16 {
+		time.Sleep(time.Millisecond)
+	}
+	ob.Close()
+}
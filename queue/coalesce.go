@@ -0,0 +1,149 @@
+package queue
+
+import (
+	"container/list"
+	"context"
+	"sync/atomic"
+)
+
+// CoalescePosition defines the position of the element pushed by PushKeyed when it replaces the element with the same key.
+type CoalescePosition string
+
+func (p CoalescePosition) String() string {
+	return string(p)
+}
+
+const (
+	// CoalesceInPlace keeps the position of the element replaced, so the key is delivered as early as it's pushed first.
+	CoalesceInPlace CoalescePosition = "in_place"
+
+	// CoalesceToTail moves the element to the tail of the queue, so the elements are delivered in the order of their latest pushing.
+	CoalesceToTail CoalescePosition = "to_tail"
+)
+
+type coalesceOptions struct {
+	position CoalescePosition
+	merge    interface{}
+}
+
+// WithCoalescePosition defines the position of the element pushed by PushKeyed when it replaces the element with the same key.
+// The default value is CoalesceInPlace.
+func WithCoalescePosition(position CoalescePosition) BufferOption {
+	return func(b *bufferOptions) {
+		b.coalesce.position = position
+	}
+}
+
+// WithCoalesceMerge defines the function for merging the element not delivered and the new element with the same key,
+// the element returned replaces them. The element is replaced by the new one directly when it's not set.
+// T must be the element type of the Buffer, or creating the Buffer will panic.
+func WithCoalesceMerge[T any](merge func(old T, new T) T) BufferOption {
+	return func(b *bufferOptions) {
+		b.coalesce.merge = merge
+	}
+}
+
+// keyedElement is the element pushed by PushKeyed in the self-defined queue, dead means it's coalesced to the tail.
+type keyedElement struct {
+	key  interface{}
+	elm  interface{}
+	dead bool
+}
+
+// PushKeyed inserts the element with the key, it replaces the element with the same key which is not delivered yet,
+// and returns PushCoalesced. The position of the element replaced is defined by WithCoalescePosition,
+// and the elements could be merged by WithCoalesceMerge. The key must be comparable.
+// The element sent to the go chan, waiting by PolicyBlock or spilled to disk is delivered already, it's not replaced.
+// When the element replacing exceeds the byte capacity, it's dropped with PolicyDrop and the element replaced is kept,
+// otherwise the element replaced is removed and the new one is pushed to the tail with the policy as Push does.
+func (b *Buffer[T]) PushKeyed(key interface{}, elm T) PushResult {
+	if atomic.CompareAndSwapInt32(&b.closed, 1, 1) {
+		b.metrics.pushed(PushDropped)
+		return PushDropped
+	}
+	// the lookup of key and the inserting are in one lock, so the elements with the same key pushed concurrently are coalesced
+	b.mu.Lock()
+	ret, elm, ok := b.coalesceKeyed(key, elm)
+	var el *list.Element
+	if !ok {
+		ret, el, _ = b.pushLocked(elm, &keyedElement{
+			key: key,
+			elm: elm,
+		})
+	}
+	b.mu.Unlock()
+	if el != nil {
+		ret, _ = b.wait(context.Background(), el)
+	}
+	b.metrics.pushed(ret)
+	return ret
+}
+
+// coalesceKeyed replaces the element with the same key, it returns false when no element with the key in the queue,
+// or the element replaced is removed as the new one exceeds the byte capacity, the element returned should be pushed then.
+// The caller must hold the lock.
+func (b *Buffer[T]) coalesceKeyed(key interface{}, elm T) (PushResult, T, bool) {
+	if atomic.CompareAndSwapInt32(&b.closed, 1, 1) {
+		return PushDropped, elm, true
+	}
+	if b.oversize(elm) {
+		return PushDropped, elm, true
+	}
+	k, ok := b.keys[key]
+	if !ok {
+		return "", elm, false
+	}
+	if b.merge != nil {
+		elm = b.merge(cast[T](k.elm), elm)
+		if b.oversize(elm) {
+			return PushDropped, elm, true
+		}
+	}
+	delta := b.sizeOf(elm) - b.sizeOf(k.elm)
+	if b.byteCapacity != 0 && delta > 0 && b.bytes+delta > b.byteCapacity {
+		if b.policy == PolicyDrop {
+			return PushDropped, elm, true
+		}
+		b.detach(key, k)
+		return "", elm, false
+	}
+	if b.coalesce.position != CoalesceToTail {
+		b.bytes += delta
+		k.elm = elm
+		return PushCoalesced, elm, true
+	}
+	b.detach(key, k)
+	b.add(&keyedElement{
+		key: key,
+		elm: elm,
+	})
+	b.wake()
+	return PushCoalesced, elm, true
+}
+
+// detach removes the keyed element from the queue, the entry is skipped when removing, it's still in the queue until then.
+// The caller must hold the lock.
+func (b *Buffer[T]) detach(key interface{}, k *keyedElement) {
+	b.bytes -= b.sizeOf(k.elm)
+	k.dead = true
+	b.dead++
+	delete(b.keys, key)
+}
+
+// unwrap returns the element of the entry in the self-defined queue, it returns false for the keyed element coalesced
+// to the tail. The caller must hold the lock.
+func (b *Buffer[T]) unwrap(entry interface{}) (T, bool) {
+	k, ok := entry.(*keyedElement)
+	if !ok {
+		return cast[T](entry), true
+	}
+	if k.dead {
+		b.dead--
+		var zero T
+		return zero, false
+	}
+	if b.keys[k.key] == k {
+		delete(b.keys, k.key)
+	}
+	return cast[T](k.elm), true
+}
@@ -0,0 +1,108 @@
+package queue
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type update struct {
+	key   string
+	value int
+	count int
+}
+
+func TestPushKeyed(t *testing.T) {
+	q := NewBufferOf[*update](WithChannelCapacity(0), WithBufferingIdleTime(0))
+	defer q.Dispose()
+	// the first element is taken by the background goroutine for sending
+	q.Push(&update{key: "x"})
+	waitFor(func() bool {
+		return q.Stats().Length == 0
+	})
+	for i := 0; i != 3; i++ {
+		q.PushKeyed("a", &update{key: "a", value: i})
+		q.PushKeyed("b", &update{key: "b", value: i})
+	}
+	q.Push(&update{key: "c"})
+	if size := q.Size(); size != 3 {
+		t.Fatalf("size[%d] is not expected", size)
+	}
+	expected := []string{"x", "a", "b", "c"}
+	for _, key := range expected {
+		v := <-q.Channel()
+		if v.key != key || key != "x" && key != "c" && v.value != 2 {
+			t.Fatalf("element[%+v] is not expected[%s]", v, key)
+		}
+	}
+	if stats := q.Stats(); stats.Coalesced != 4 {
+		t.Fatalf("coalesced count[%d] is not expected", stats.Coalesced)
+	}
+}
+
+func TestPushKeyedConcurrent(t *testing.T) {
+	for n := 0; n != 100; n++ {
+		q := NewBufferOf[*update](WithChannelCapacity(0), WithBufferingIdleTime(0))
+		q.Push(&update{key: "x"})
+		waitFor(func() bool {
+			return q.Stats().Length == 0
+		})
+		var wg sync.WaitGroup
+		for i := 0; i != 4; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for k := 0; k != 3; k++ {
+					key := strconv.Itoa(k)
+					q.PushKeyed(key, &update{key: key, value: i})
+				}
+			}(i)
+		}
+		wg.Wait()
+		// one pending element for each key
+		if length := q.Stats().Length; length != 3 {
+			t.Fatalf("queue length[%d] is not expected", length)
+		}
+		q.Dispose()
+	}
+}
+
+func TestPushKeyedToTail(t *testing.T) {
+	q := NewBufferOf[*update](WithChannelCapacity(0), WithBufferingIdleTime(0), WithQueueCapacity(3),
+		WithCoalescePosition(CoalesceToTail),
+		WithCoalesceMerge(func(old *update, new *update) *update {
+			new.count = old.count + 1
+			return new
+		}))
+	q.Push(&update{key: "x"})
+	waitFor(func() bool {
+		return q.Stats().Length == 0
+	})
+	q.PushKeyed("a", &update{key: "a", value: 0})
+	q.PushKeyed("b", &update{key: "b", value: 0})
+	q.PushKeyed("a", &update{key: "a", value: 1})
+	q.PushKeyed("c", &update{key: "c", value: 0})
+	// the element coalesced to the tail is not counted in the capacity
+	if ret := q.PushKeyed("d", &update{key: "d"}); ret != PushDropped {
+		t.Fatalf("push result[%s] is not expected", ret)
+	}
+	<-q.Channel()
+	vv := q.Dispose()
+	if len(vv) != 3 || vv[0].key != "b" || vv[1].key != "a" || vv[2].key != "c" {
+		t.Fatalf("disposed elements are not expected: %v", vv)
+	}
+	if vv[1].value != 1 || vv[1].count != 1 {
+		t.Fatalf("element merged[%+v] is not expected", vv[1])
+	}
+}
+
+func TestCoalesceMergeMismatch(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("creating the Buffer with mismatched merge function does not panic")
+		}
+	}()
+	NewBufferOf[int](WithCoalesceMerge(func(old string, new string) string {
+		return new
+	}))
+}
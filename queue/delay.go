@@ -0,0 +1,107 @@
+package queue
+
+import (
+	"container/heap"
+	"sync/atomic"
+	"time"
+)
+
+// PushDelayed inserts the element which is deliverable after the duration d, it's the same as PushAt with time.Now().Add(d).
+func (b *Buffer[T]) PushDelayed(elm T, d time.Duration) PushResult {
+	return b.PushAt(elm, time.Now().Add(d))
+}
+
+// PushAt inserts the element which is deliverable at the time t, it returns PushToDelay when the element is waiting for the time.
+// Elements delayed are inserted to the queue in the order of due time when they are due, the elements with the same due time
+// keep the order of pushing. Then they are delivered with the elements pushed immediately in order,
+// the queue capacity and policy are applied at the time, but PolicyBlock is not waiting for them.
+// The delayed elements are kept in memory even if WithDiskSpill is set, Dispose returns them after all other elements.
+// The element with the time not after now is pushed immediately as Push.
+func (b *Buffer[T]) PushAt(elm T, t time.Time) PushResult {
+	if !t.After(time.Now()) {
+		return b.Push(elm)
+	}
+	ret := b.pushAt(elm, t)
+	b.metrics.pushed(ret)
+	return ret
+}
+
+func (b *Buffer[T]) pushAt(elm T, t time.Time) PushResult {
+	if atomic.CompareAndSwapInt32(&b.closed, 1, 1) {
+		return PushDropped
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if atomic.CompareAndSwapInt32(&b.closed, 1, 1) {
+		return PushDropped
+	}
+	if b.oversize(elm) {
+		return PushDropped
+	}
+	b.delayed.seq++
+	heap.Push(b.delayed, &delayedElement[T]{
+		elm: elm,
+		due: t,
+		seq: b.delayed.seq,
+	})
+	b.wake()
+	return PushToDelay
+}
+
+// delayedElement is the element waiting for its due time.
+type delayedElement[T any] struct {
+	elm T
+	due time.Time
+	seq uint64
+}
+
+// delayHeap is the heap of delayed elements which top is the first due one.
+type delayHeap[T any] struct {
+	elements []*delayedElement[T]
+	seq      uint64
+}
+
+func (h *delayHeap[T]) Len() int {
+	return len(h.elements)
+}
+
+func (h *delayHeap[T]) Less(i, j int) bool {
+	x, y := h.elements[i], h.elements[j]
+	if !x.due.Equal(y.due) {
+		return x.due.Before(y.due)
+	}
+	return x.seq < y.seq
+}
+
+func (h *delayHeap[T]) Swap(i, j int) {
+	h.elements[i], h.elements[j] = h.elements[j], h.elements[i]
+}
+
+func (h *delayHeap[T]) Push(x interface{}) {
+	h.elements = append(h.elements, x.(*delayedElement[T]))
+}
+
+func (h *delayHeap[T]) Pop() interface{} {
+	e := h.elements[len(h.elements)-1]
+	h.elements[len(h.elements)-1] = nil
+	h.elements = h.elements[:len(h.elements)-1]
+	return e
+}
+
+// promote inserts the delayed elements which are due to the queue, the caller must hold the lock.
+func (b *Buffer[T]) promote() {
+	now := time.Now()
+	for b.delayed.Len() != 0 && !b.delayed.elements[0].due.After(now) {
+		e := heap.Pop(b.delayed).(*delayedElement[T])
+		b.insert(e.elm)
+	}
+}
+
+// due returns the timer fired when the first delayed element is due, it returns nil when no delayed elements.
+// The caller must hold the lock.
+func (b *Buffer[T]) due() *time.Timer {
+	if b.delayed.Len() == 0 {
+		return nil
+	}
+	return time.NewTimer(time.Until(b.delayed.elements[0].due))
+}
@@ -0,0 +1,57 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPushDelayed(t *testing.T) {
+	q := NewBufferOf[int](WithChannelCapacity(0))
+	now := time.Now()
+	if ret := q.PushAt(3, now.Add(60*time.Millisecond)); ret != PushToDelay {
+		t.Fatalf("push result[%s] is not expected", ret)
+	}
+	q.PushAt(1, now.Add(20*time.Millisecond))
+	q.PushAt(2, now.Add(20*time.Millisecond))
+	q.PushDelayed(4, time.Hour)
+	q.Push(0)
+	if size := q.Size(); size != 5 {
+		t.Fatalf("size[%d] is not expected", size)
+	}
+
+	for i := 0; i != 4; i++ {
+		if v := <-q.Channel(); v != i {
+			t.Fatalf("element[%d] is not expected[%d]", v, i)
+		}
+		if i == 1 && time.Since(now) < 20*time.Millisecond || i == 3 && time.Since(now) < 60*time.Millisecond {
+			t.Fatalf("element[%d] is delivered before due", i)
+		}
+	}
+	stats := q.Stats()
+	if stats.PushedToDelay != 4 || stats.Delayed != 1 {
+		t.Fatalf("stats of delayed elements are not expected: %+v", stats)
+	}
+	q.PushDelayed(5, 10*time.Minute)
+	vv := q.Dispose()
+	if len(vv) != 2 || vv[0] != 5 || vv[1] != 4 {
+		t.Fatalf("disposed%v is not expected", vv)
+	}
+	if ret := q.PushDelayed(6, time.Second); ret != PushDropped {
+		t.Fatalf("push result[%s] after Dispose is not expected", ret)
+	}
+}
+
+func TestPushDelayedIdle(t *testing.T) {
+	// the background goroutine keeps waiting for the delayed elements after idle time
+	q := NewBuffer(WithChannelCapacity(0), WithBufferingIdleTime(time.Millisecond))
+	defer q.Dispose()
+	q.PushDelayed(1, 20*time.Millisecond)
+	select {
+	case v := <-q.Channel():
+		if v != 1 {
+			t.Fatalf("element[%v] is not expected", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("delayed element is not delivered")
+	}
+}
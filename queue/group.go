@@ -0,0 +1,291 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"github.com/eapache/queue"
+	"github.com/more-infra/base"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	ErrTypeGroupClosed   = "queue.group_closed"
+	ErrTypeLeaseNotFound = "queue.lease_not_found"
+)
+
+var (
+	ErrGroupClosed   = errors.New("consumer group has been closed")
+	ErrLeaseNotFound = errors.New("lease is not found, it has been acknowledged or expired")
+)
+
+const (
+	DefaultVisibilityTimeout = 30 * time.Second
+)
+
+// Group is the consumer group receiving elements from a Buffer with acknowledgement, see Buffer.NewGroup.
+// Consumers call Receive for a Lease of the element, and call Lease.Ack when it's processed, or Lease.Nack for redelivering it.
+// The element which is not acknowledged in the visibility timeout is redelivered to another Receive,
+// and the element delivered more than max deliveries times is pushed to the dead-letter Buffer.
+// The elements redelivered are received before the elements in the Buffer.
+//
+// All methods of Group are thread-safe.
+type Group[T any] struct {
+	groupOptions
+	source     *Buffer[T]
+	deadLetter *Buffer[T]
+	mu         sync.Mutex
+	sign       chan struct{}
+	done       chan struct{}
+	closed     bool
+	seq        uint64
+	leases     map[uint64]*Lease[T]
+	redelivery *queue.Queue
+}
+
+type groupOptions struct {
+	timeout           time.Duration
+	maxDeliveries     int
+	deadLetterOptions []BufferOption
+}
+
+type GroupOption func(*groupOptions)
+
+// WithVisibilityTimeout defines the time a Lease is kept for the consumer, the element will be redelivered
+// when the Lease is not acknowledged after it. The default value is 30 seconds.
+func WithVisibilityTimeout(timeout time.Duration) GroupOption {
+	return func(o *groupOptions) {
+		o.timeout = timeout
+	}
+}
+
+// WithMaxDeliveries defines the max count of delivering an element, the element is pushed to the dead-letter Buffer
+// instead of redelivering when it's reached. The default value 0 means unlimited.
+func WithMaxDeliveries(n int) GroupOption {
+	return func(o *groupOptions) {
+		o.maxDeliveries = n
+	}
+}
+
+// WithDeadLetterOptions defines the options for creating the dead-letter Buffer.
+func WithDeadLetterOptions(options ...BufferOption) GroupOption {
+	return func(o *groupOptions) {
+		o.deadLetterOptions = append(o.deadLetterOptions, options...)
+	}
+}
+
+// NewGroup creates a consumer group receiving elements from the Buffer, the elements received by the go chan directly
+// are not managed by the Group, so the Buffer should be consumed by the Group only.
+// The Close method is required to call when the Group is not used.
+func (b *Buffer[T]) NewGroup(options ...GroupOption) *Group[T] {
+	g := &Group[T]{
+		groupOptions: groupOptions{
+			timeout: DefaultVisibilityTimeout,
+		},
+		source:     b,
+		sign:       make(chan struct{}, 1),
+		done:       make(chan struct{}),
+		leases:     make(map[uint64]*Lease[T]),
+		redelivery: queue.New(),
+	}
+	for _, op := range options {
+		op(&g.groupOptions)
+	}
+	g.deadLetter = NewBufferOf[T](g.deadLetterOptions...)
+	return g
+}
+
+// Lease is an element received by a consumer of Group, it's kept for the consumer until acknowledged or the visibility timeout.
+type Lease[T any] struct {
+	// Element is the element received.
+	Element T
+
+	// Deliveries is the count of delivering the element, including this one.
+	Deliveries int
+
+	group *Group[T]
+	id    uint64
+	timer *time.Timer
+}
+
+// Ack acknowledges the element is processed, it will not be redelivered.
+// It returns ErrLeaseNotFound typed ErrTypeLeaseNotFound when the Lease has been acknowledged or expired.
+func (l *Lease[T]) Ack() error {
+	g := l.group
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return g.remove(l)
+}
+
+// Nack gives up the element, it will be redelivered at once, or pushed to the dead-letter Buffer when max deliveries reached.
+// It returns ErrLeaseNotFound typed ErrTypeLeaseNotFound when the Lease has been acknowledged or expired.
+func (l *Lease[T]) Nack() error {
+	g := l.group
+	g.mu.Lock()
+	if err := g.remove(l); err != nil {
+		g.mu.Unlock()
+		return err
+	}
+	dead := g.requeue(l)
+	g.mu.Unlock()
+	if dead {
+		g.deadLetter.Push(l.Element)
+	}
+	return nil
+}
+
+// Receive waits for an element and returns the Lease of it.
+// It returns ErrGroupClosed typed ErrTypeGroupClosed when the Group is closed, ErrBufferDisposed typed ErrTypeBufferDisposed
+// when the Buffer is disposed, and the error of context when it's done.
+// When the Group is closed while an element is being received, the Lease of it is returned with ErrGroupClosed,
+// it's not managed by the Group and could not be acknowledged, so the caller should handle or keep the element.
+func (g *Group[T]) Receive(ctx context.Context) (*Lease[T], error) {
+	for {
+		g.mu.Lock()
+		if g.closed {
+			g.mu.Unlock()
+			return nil, base.NewErrorWithType(ErrTypeGroupClosed, ErrGroupClosed)
+		}
+		if g.redelivery.Length() != 0 {
+			l := g.redelivery.Remove().(*Lease[T])
+			if g.redelivery.Length() != 0 {
+				// wake up another consumer for the remaining
+				g.signal()
+			}
+			l = g.lease(l.Element, l.Deliveries)
+			g.mu.Unlock()
+			return l, nil
+		}
+		g.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-g.done:
+		case <-g.sign:
+		case elm, ok := <-g.source.Channel():
+			if !ok {
+				return nil, errDisposed()
+			}
+			g.mu.Lock()
+			if g.closed {
+				g.mu.Unlock()
+				// the element received while closing is given to the caller, it's not managed by the Group
+				return &Lease[T]{
+					Element:    elm,
+					Deliveries: 1,
+					group:      g,
+				}, base.NewErrorWithType(ErrTypeGroupClosed, ErrGroupClosed)
+			}
+			l := g.lease(elm, 0)
+			g.mu.Unlock()
+			return l, nil
+		}
+	}
+}
+
+// DeadLetter returns the Buffer which receives the elements delivered more than max deliveries times.
+// It's not disposed by Close, the caller should dispose it when it's not used.
+func (g *Group[T]) DeadLetter() *Buffer[T] {
+	return g.deadLetter
+}
+
+// Pending returns the count of elements received but not acknowledged, including the elements waiting for redelivering.
+func (g *Group[T]) Pending() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.leases) + g.redelivery.Length()
+}
+
+// Close stops the Group, and returns the elements not acknowledged, the Leases of them could not be acknowledged anymore.
+// The Buffer of the Group is not disposed.
+func (g *Group[T]) Close() []T {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return nil
+	}
+	g.closed = true
+	close(g.done)
+	ids := make([]uint64, 0, len(g.leases))
+	for id := range g.leases {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	var vv []T
+	for _, id := range ids {
+		l := g.leases[id]
+		l.timer.Stop()
+		vv = append(vv, l.Element)
+	}
+	g.leases = make(map[uint64]*Lease[T])
+	for g.redelivery.Length() != 0 {
+		vv = append(vv, g.redelivery.Remove().(*Lease[T]).Element)
+	}
+	return vv
+}
+
+// lease creates the Lease of the element delivered, the caller must hold the lock.
+func (g *Group[T]) lease(elm T, deliveries int) *Lease[T] {
+	g.seq++
+	l := &Lease[T]{
+		Element:    elm,
+		Deliveries: deliveries + 1,
+		group:      g,
+		id:         g.seq,
+	}
+	g.leases[l.id] = l
+	l.timer = time.AfterFunc(g.timeout, func() {
+		g.expire(l)
+	})
+	return l
+}
+
+// remove deletes the Lease in the Group, the caller must hold the lock.
+func (g *Group[T]) remove(l *Lease[T]) error {
+	if g.leases[l.id] != l {
+		return base.NewErrorWithType(ErrTypeLeaseNotFound, ErrLeaseNotFound).
+			WithField("lease_id", l.id)
+	}
+	delete(g.leases, l.id)
+	l.timer.Stop()
+	return nil
+}
+
+func (g *Group[T]) expire(l *Lease[T]) {
+	g.mu.Lock()
+	if g.leases[l.id] != l {
+		g.mu.Unlock()
+		return
+	}
+	delete(g.leases, l.id)
+	dead := g.requeue(l)
+	g.mu.Unlock()
+	if dead {
+		g.deadLetter.Push(l.Element)
+	}
+}
+
+// requeue redelivers the element of the Lease, it returns true when max deliveries reached,
+// and the caller should push the element to the dead-letter Buffer after the lock released,
+// as the dead-letter Buffer with queue.PolicyBlock may wait. The caller must hold the lock.
+func (g *Group[T]) requeue(l *Lease[T]) bool {
+	if g.maxDeliveries > 0 && l.Deliveries >= g.maxDeliveries {
+		return true
+	}
+	g.redelivery.Add(&Lease[T]{
+		Element:    l.Element,
+		Deliveries: l.Deliveries,
+	})
+	g.signal()
+	return false
+}
+
+func (g *Group[T]) signal() {
+	select {
+	case g.sign <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,206 @@
+package queue
+
+import (
+	"context"
+	"github.com/more-infra/base"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	q := NewBufferOf[int]()
+	defer q.Dispose()
+	g := q.NewGroup(WithVisibilityTimeout(50*time.Millisecond), WithMaxDeliveries(2))
+	defer g.DeadLetter().Dispose()
+	for i := 0; i != 3; i++ {
+		q.Push(i)
+	}
+	ctx := context.Background()
+
+	l0, err := g.Receive(ctx)
+	if err != nil || l0.Element != 0 || l0.Deliveries != 1 {
+		t.Fatalf("lease[%+v] is not expected: %v", l0, err)
+	}
+	if err := l0.Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if err := l0.Ack(); base.ErrorType(err) != ErrTypeLeaseNotFound {
+		t.Fatalf("ack twice error[%v] is not expected", err)
+	}
+
+	// Nack redelivers before the elements in the Buffer
+	l1, _ := g.Receive(ctx)
+	if err := l1.Nack(); err != nil {
+		t.Fatal(err)
+	}
+	l1, _ = g.Receive(ctx)
+	if l1.Element != 1 || l1.Deliveries != 2 {
+		t.Fatalf("redelivered lease[%+v] is not expected", l1)
+	}
+	// max deliveries reached, it goes to dead-letter
+	l1.Nack()
+	select {
+	case v := <-g.DeadLetter().Channel():
+		if v != 1 {
+			t.Fatalf("dead-letter element[%d] is not expected", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("dead-letter element is not received")
+	}
+
+	// not acknowledged in visibility timeout
+	l2, _ := g.Receive(ctx)
+	start := time.Now()
+	redelivered, err := g.Receive(ctx)
+	if err != nil || redelivered.Element != 2 || redelivered.Deliveries != 2 {
+		t.Fatalf("redelivered lease[%+v] is not expected: %v", redelivered, err)
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Fatal("element is redelivered before visibility timeout")
+	}
+	if err := l2.Ack(); base.ErrorType(err) != ErrTypeLeaseNotFound {
+		t.Fatalf("ack expired lease error[%v] is not expected", err)
+	}
+	if n := g.Pending(); n != 1 {
+		t.Fatalf("pending[%d] is not expected", n)
+	}
+
+	c, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := g.Receive(c); err != context.DeadlineExceeded {
+		t.Fatalf("receive error[%v] is not expected", err)
+	}
+
+	vv := g.Close()
+	if len(vv) != 1 || vv[0] != 2 {
+		t.Fatalf("closed%v is not expected", vv)
+	}
+	if _, err := g.Receive(ctx); base.ErrorType(err) != ErrTypeGroupClosed {
+		t.Fatalf("receive error[%v] after Close is not expected", err)
+	}
+	if err := redelivered.Ack(); base.ErrorType(err) != ErrTypeLeaseNotFound {
+		t.Fatalf("ack error[%v] after Close is not expected", err)
+	}
+}
+
+func TestGroupConsumers(t *testing.T) {
+	const count = 100
+	q := NewBufferOf[int]()
+	g := q.NewGroup(WithVisibilityTimeout(time.Second))
+	defer g.DeadLetter().Dispose()
+	received := make(chan int, count)
+	for i := 0; i != 4; i++ {
+		go func(i int) {
+			for {
+				l, err := g.Receive(context.Background())
+				if err != nil {
+					return
+				}
+				// every consumer gives up the first delivery of the element once
+				if l.Deliveries == 1 && l.Element%4 == i {
+					l.Nack()
+					continue
+				}
+				l.Ack()
+				received <- l.Element
+			}
+		}(i)
+	}
+	for i := 0; i != count; i++ {
+		q.Push(i)
+	}
+	seen := make(map[int]bool)
+	for len(seen) != count {
+		select {
+		case v := <-received:
+			if seen[v] {
+				t.Fatalf("element[%d] is acknowledged twice", v)
+			}
+			seen[v] = true
+		case <-time.After(time.Second):
+			t.Fatalf("elements are not all received, %d received", len(seen))
+		}
+	}
+	if vv := g.Close(); len(vv) != 0 {
+		t.Fatalf("closed%v is not expected", vv)
+	}
+	q.Dispose()
+}
+
+func TestGroupDeadLetterBlock(t *testing.T) {
+	q := NewBufferOf[int]()
+	defer q.Dispose()
+	g := q.NewGroup(WithMaxDeliveries(1), WithDeadLetterOptions(WithChannelCapacity(0),
+		WithQueueCapacity(1), WithQueuePolicy(PolicyBlock)))
+	defer g.Close()
+	defer g.DeadLetter().Dispose()
+	var leases []*Lease[int]
+	for i := 0; i != 4; i++ {
+		q.Push(i)
+		l, _ := g.Receive(context.Background())
+		leases = append(leases, l)
+	}
+	leases[0].Nack()
+	waitFor(func() bool {
+		// the head element is held by the background goroutine
+		return g.DeadLetter().Stats().Length == 0
+	})
+	leases[1].Nack()
+	nacked := make(chan struct{})
+	go func() {
+		// the dead-letter Buffer is full, it waits without the lock of Group
+		leases[2].Nack()
+		close(nacked)
+	}()
+	waitFor(func() bool {
+		return g.DeadLetter().waiting() == 1
+	})
+	if err := leases[3].Ack(); err != nil {
+		t.Fatal(err)
+	}
+	if n := g.Pending(); n != 0 {
+		t.Fatalf("pending[%d] is not expected", n)
+	}
+	for i := 0; i != 3; i++ {
+		if v := <-g.DeadLetter().Channel(); v != i {
+			t.Fatalf("dead-letter element[%d] is not expected[%d]", v, i)
+		}
+	}
+	<-nacked
+}
+
+func TestGroupCloseReceiving(t *testing.T) {
+	for i := 0; i != 20; i++ {
+		q := NewBufferOf[int](WithChannelCapacity(1))
+		g := q.NewGroup()
+		type result struct {
+			l   *Lease[int]
+			err error
+		}
+		received := make(chan result)
+		go func() {
+			l, err := g.Receive(context.Background())
+			received <- result{l, err}
+		}()
+		time.Sleep(time.Millisecond)
+		g.Close()
+		q.Push(i)
+		// the element is kept in the source, or given to the caller if it's received while closing
+		ret := <-received
+		if base.ErrorType(ret.err) != ErrTypeGroupClosed {
+			t.Fatalf("receive error[%v] is not expected", ret.err)
+		}
+		if ret.l != nil {
+			if ret.l.Element != i {
+				t.Fatalf("element[%d] is not expected[%d]", ret.l.Element, i)
+			}
+			if err := ret.l.Ack(); base.ErrorType(err) != ErrTypeLeaseNotFound {
+				t.Fatalf("ack error[%v] is not expected", err)
+			}
+		} else if v, ok := q.TryPop(); !ok || v != i {
+			t.Fatalf("element[%d] is lost", i)
+		}
+		g.DeadLetter().Dispose()
+		q.Dispose()
+	}
+}
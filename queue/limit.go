@@ -0,0 +1,105 @@
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// WithRateLimit paces the delivery of elements to the go chan by a token bucket, at most rate elements per second
+// are sent on average, and burst elements could be sent at once after idle. The elements exceeding the limit are kept in the Buffer,
+// and the queue capacity and policy are applied to them as usual. The rate limit could be changed by SetRateLimit.
+// The elements in the go chan have been paced already, so set a small channel capacity for pacing the consumer precisely.
+// The default value is unlimited.
+func WithRateLimit(rate float64, burst int) BufferOption {
+	return func(b *bufferOptions) {
+		b.limiter.set(rate, burst)
+	}
+}
+
+// SetRateLimit changes the rate limit dynamically, see WithRateLimit. The rate not greater than 0 means unlimited.
+func (b *Buffer[T]) SetRateLimit(rate float64, burst int) {
+	b.limiter.set(rate, burst)
+	select {
+	case b.limited <- struct{}{}:
+	default:
+	}
+}
+
+// tokenBucket is the token bucket limiter, the bucket is full when it's created.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+func (tb *tokenBucket) set(rate float64, burst int) {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if burst < 1 {
+		burst = 1
+	}
+	now := time.Now()
+	if tb.rate > 0 {
+		tb.refill(now)
+	} else {
+		tb.tokens = float64(burst)
+	}
+	tb.rate, tb.burst, tb.last = rate, burst, now
+	if tb.tokens > float64(burst) {
+		tb.tokens = float64(burst)
+	}
+}
+
+// take consumes a token and returns 0 when it's available, or returns the time to wait for the next token without consuming.
+func (tb *tokenBucket) take() time.Duration {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.rate <= 0 {
+		return 0
+	}
+	now := time.Now()
+	tb.refill(now)
+	if tb.tokens >= 1 {
+		tb.tokens--
+		return 0
+	}
+	return time.Duration((1 - tb.tokens) / tb.rate * float64(time.Second))
+}
+
+// put returns the token taken but not used.
+func (tb *tokenBucket) put() {
+	tb.mu.Lock()
+	defer tb.mu.Unlock()
+	if tb.rate > 0 && tb.tokens+1 <= float64(tb.burst) {
+		tb.tokens++
+	}
+}
+
+func (tb *tokenBucket) refill(now time.Time) {
+	tb.tokens += now.Sub(tb.last).Seconds() * tb.rate
+	if tb.tokens > float64(tb.burst) {
+		tb.tokens = float64(tb.burst)
+	}
+	tb.last = now
+}
+
+// pace waits for a token before sending an element, it returns false when the Buffer is disposed.
+func (b *Buffer[T]) pace() bool {
+	for {
+		d := b.limiter.take()
+		if d == 0 {
+			return true
+		}
+		timer := time.NewTimer(d)
+		select {
+		case <-b.runner.Quit():
+			timer.Stop()
+			return false
+		case <-b.limited:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
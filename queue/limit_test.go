@@ -0,0 +1,45 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	const (
+		rate  = 100
+		burst = 5
+		num   = 25
+	)
+	q := NewBufferOf[int](WithChannelCapacity(0), WithRateLimit(rate, burst), WithQueueCapacity(num), WithQueuePolicy(PolicyDrop))
+	defer q.Dispose()
+	for i := 0; i != num+1; i++ {
+		q.Push(i)
+	}
+	// the excess is kept by the capacity policy, the element taken by the background goroutine is not counted
+	dropped := int(q.Stats().Dropped)
+	if dropped > 1 {
+		t.Fatalf("dropped count[%d] is not expected", dropped)
+	}
+	start := time.Now()
+	for i := 0; i != num+1-dropped; i++ {
+		if v := <-q.Channel(); v != i {
+			t.Fatalf("element[%d] is not expected[%d]", v, i)
+		}
+	}
+	// the burst is sent at once, and the others are paced by the rate
+	expected := time.Duration(num-burst) * time.Second / rate
+	if elapsed := time.Since(start); elapsed < expected*8/10 {
+		t.Fatalf("elapsed[%s] is less than expected[%s]", elapsed, expected)
+	}
+
+	// changing the rate limit wakes the sending waiting for the token
+	q.SetRateLimit(0.1, 1)
+	q.Push(100)
+	time.Sleep(10 * time.Millisecond)
+	start = time.Now()
+	q.SetRateLimit(0, 0)
+	if v := <-q.Channel(); v != 100 || time.Since(start) > time.Second {
+		t.Fatalf("element[%d] is not delivered after rate limit removed", v)
+	}
+}
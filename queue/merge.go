@@ -0,0 +1,319 @@
+package queue
+
+import (
+	"errors"
+	"github.com/more-infra/base"
+	"github.com/more-infra/base/runner"
+	"reflect"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	ErrTypeMergerClosed      = "queue.merger_closed"
+	ErrTypeMergeInputExisted = "queue.merge_input_existed"
+)
+
+var (
+	ErrMergerClosed      = errors.New("merger has been closed")
+	ErrMergeInputExisted = errors.New("merge input with the name is existed")
+)
+
+// MergeStrategy defines how Merger selects the input when more than one input has elements ready.
+type MergeStrategy string
+
+func (s MergeStrategy) String() string {
+	return string(s)
+}
+
+const (
+	// MergeRoundRobin selects the inputs in turn, the weights are ignored.
+	MergeRoundRobin MergeStrategy = "round_robin"
+
+	// MergeWeighted selects the inputs in proportion to their weights, and interleaves them smoothly
+	// instead of delivering the elements of an input in a burst.
+	MergeWeighted MergeStrategy = "weighted"
+)
+
+// Merger merges the elements of multiple Buffers into one go chan fairly. The elements are moved from the inputs only when
+// the go chan is consumed, so the input which is pushed heavily could not starve others.
+// The inputs could be added and removed at any time, and each of them is identified by a name.
+//
+// The Merger is the consumer of the inputs, the elements received from the inputs by others are not merged.
+// The disposed input is removed automatically. The strategy works on the inputs with the go chan capacity, see WithChannelCapacity,
+// the inputs without it are selected randomly as they are ready only when receiving.
+//
+// All methods of Merger are thread-safe.
+type Merger[T any] struct {
+	mergeOptions
+	runner *runner.Runner
+	mu     sync.Mutex
+	inputs []*mergeInput[T]
+	update chan struct{}
+	ch     chan T
+	closed int32
+	unsent *T
+}
+
+type mergeOptions struct {
+	strategy   MergeStrategy
+	chCapacity int
+}
+
+type MergeOption func(*mergeOptions)
+
+// WithMergeStrategy defines the strategy for selecting the inputs, the default value is MergeRoundRobin.
+func WithMergeStrategy(strategy MergeStrategy) MergeOption {
+	return func(o *mergeOptions) {
+		o.strategy = strategy
+	}
+}
+
+// WithMergeChannelCapacity set the capacity of the go chan of Merger, the elements in it are selected already,
+// so the larger capacity makes the selection less fair. The default value is 0.
+func WithMergeChannelCapacity(cap int) MergeOption {
+	return func(o *mergeOptions) {
+		o.chCapacity = cap
+	}
+}
+
+// MergeInput is the snapshot of an input of Merger returned by Merger.Inputs.
+type MergeInput struct {
+	// Name is the name of input defined by Merger.Add.
+	Name string
+
+	// Weight is the weight of input defined by Merger.Add.
+	Weight int
+
+	// Merged is the count of elements of the input sent to the go chan of Merger.
+	Merged uint64
+
+	// Size is the count of elements in the input Buffer, see Buffer.Size.
+	Size int
+}
+
+type mergeInput[T any] struct {
+	name    string
+	buffer  *Buffer[T]
+	weight  int
+	current int
+	merged  uint64
+}
+
+// NewMerger creates the Merger without inputs, use Add for adding them.
+// The Close method is required to call when the Merger is not used, or leak of goroutine will be happened.
+func NewMerger[T any](options ...MergeOption) *Merger[T] {
+	m := &Merger[T]{
+		mergeOptions: mergeOptions{
+			strategy: MergeRoundRobin,
+		},
+		runner: runner.NewRunner(),
+		update: make(chan struct{}, 1),
+	}
+	for _, op := range options {
+		op(&m.mergeOptions)
+	}
+	m.ch = make(chan T, m.chCapacity)
+	m.runner.Mark()
+	go m.running()
+	return m
+}
+
+// Add adds the input Buffer with the name, the weight is used by MergeWeighted and it's 1 when less than 1.
+// It returns ErrMergeInputExisted typed ErrTypeMergeInputExisted when the name is existed,
+// and ErrMergerClosed typed ErrTypeMergerClosed when the Merger is closed.
+func (m *Merger[T]) Add(name string, input *Buffer[T], weight int) error {
+	if weight < 1 {
+		weight = 1
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if atomic.LoadInt32(&m.closed) != 0 {
+		return base.NewErrorWithType(ErrTypeMergerClosed, ErrMergerClosed)
+	}
+	for _, in := range m.inputs {
+		if in.name == name {
+			return base.NewErrorWithType(ErrTypeMergeInputExisted, ErrMergeInputExisted).
+				WithField("name", name)
+		}
+	}
+	m.inputs = append(m.inputs, &mergeInput[T]{
+		name:   name,
+		buffer: input,
+		weight: weight,
+	})
+	m.notify()
+	return nil
+}
+
+// Remove removes the input with the name, it returns false when the name is not existed.
+// The input Buffer is not disposed, the elements in it are kept, except the one being received by Merger at the time.
+func (m *Merger[T]) Remove(name string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i, in := range m.inputs {
+		if in.name == name {
+			m.inputs = append(m.inputs[:i:i], m.inputs[i+1:]...)
+			m.notify()
+			return true
+		}
+	}
+	return false
+}
+
+// Inputs returns the snapshot of inputs in the order of adding.
+func (m *Merger[T]) Inputs() []MergeInput {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	inputs := make([]MergeInput, 0, len(m.inputs))
+	for _, in := range m.inputs {
+		inputs = append(inputs, MergeInput{
+			Name:   in.name,
+			Weight: in.weight,
+			Merged: atomic.LoadUint64(&in.merged),
+			Size:   in.buffer.Size(),
+		})
+	}
+	return inputs
+}
+
+// Channel returns the receiver chan of the merged elements. The chan will be closed after Close method is called.
+func (m *Merger[T]) Channel() <-chan T {
+	return m.ch
+}
+
+// Close stops merging, and returns the elements moved from the inputs but not received from the go chan.
+// The input Buffers are not disposed.
+func (m *Merger[T]) Close() []T {
+	if !atomic.CompareAndSwapInt32(&m.closed, 0, 1) {
+		return nil
+	}
+	m.runner.CloseWait()
+	var vv []T
+	func() {
+		for {
+			select {
+			case v := <-m.ch:
+				vv = append(vv, v)
+			default:
+				return
+			}
+		}
+	}()
+	if m.unsent != nil {
+		vv = append(vv, *m.unsent)
+	}
+	close(m.ch)
+	return vv
+}
+
+func (m *Merger[T]) running() {
+	defer m.runner.Done()
+	for {
+		e, in := m.next()
+		if in == nil {
+			var quit bool
+			if e, in, quit = m.wait(); quit {
+				return
+			}
+			if in == nil {
+				continue
+			}
+		}
+		select {
+		case <-m.runner.Quit():
+			m.unsent = &e
+			return
+		case m.ch <- e:
+			atomic.AddUint64(&in.merged, 1)
+		}
+	}
+}
+
+// next pops the element of the input selected from the inputs which have elements ready, it returns nil input when none is ready.
+func (m *Merger[T]) next() (T, *mergeInput[T]) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var (
+		selected *mergeInput[T]
+		total    int
+	)
+	for _, in := range m.inputs {
+		if !in.buffer.ready() {
+			continue
+		}
+		// the smooth weighted round-robin among the inputs ready
+		weight := 1
+		if m.strategy == MergeWeighted {
+			weight = in.weight
+		}
+		in.current += weight
+		total += weight
+		if selected == nil || in.current > selected.current {
+			selected = in
+		}
+	}
+	if selected == nil {
+		var zero T
+		return zero, nil
+	}
+	selected.current -= total
+	e, ok := selected.buffer.TryPop()
+	if !ok {
+		// the element is received by others
+		return e, nil
+	}
+	return e, selected
+}
+
+// wait waits for the element of any input when none is ready, or the inputs changed.
+// It returns nil input when the inputs changed, and true when the Merger is closed.
+func (m *Merger[T]) wait() (T, *mergeInput[T], bool) {
+	m.mu.Lock()
+	inputs := append([]*mergeInput[T](nil), m.inputs...)
+	m.mu.Unlock()
+	cases := make([]reflect.SelectCase, 0, len(inputs)+2)
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(m.runner.Quit()),
+	}, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(m.update),
+	})
+	for _, in := range inputs {
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(in.buffer.Channel()),
+		})
+	}
+	var zero T
+	n, v, ok := reflect.Select(cases)
+	switch n {
+	case 0:
+		return zero, nil, true
+	case 1:
+		return zero, nil, false
+	}
+	in := inputs[n-2]
+	if !ok {
+		// the input is disposed
+		m.mu.Lock()
+		for i := range m.inputs {
+			if m.inputs[i] == in {
+				m.inputs = append(m.inputs[:i:i], m.inputs[i+1:]...)
+				break
+			}
+		}
+		m.mu.Unlock()
+		return zero, nil, false
+	}
+	return cast[T](v.Interface()), in, false
+}
+
+// notify wakes up the background goroutine waiting for the inputs, the caller must hold the lock.
+func (m *Merger[T]) notify() {
+	select {
+	case m.update <- struct{}{}:
+	default:
+	}
+}
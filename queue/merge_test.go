@@ -0,0 +1,150 @@
+package queue
+
+import (
+	"github.com/more-infra/base"
+	"testing"
+	"time"
+)
+
+func TestMerger(t *testing.T) {
+	for _, c := range []struct {
+		strategy MergeStrategy
+		weights  []int
+		expect   []int
+	}{
+		{MergeRoundRobin, []int{3, 1, 1}, []int{100, 100, 100}},
+		{MergeWeighted, []int{3, 1, 1}, []int{180, 60, 60}},
+	} {
+		m := NewMerger[string](WithMergeStrategy(c.strategy))
+		names := []string{"a", "b", "c"}
+		var inputs []*Buffer[string]
+		for i, name := range names {
+			// all elements are ready in the go chan, so the selection is not affected by the background goroutine
+			q := NewBufferOf[string](WithChannelCapacity(500))
+			for n := 0; n != 500; n++ {
+				q.Push(name)
+			}
+			inputs = append(inputs, q)
+			if err := m.Add(name, q, c.weights[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := m.Add("a", inputs[0], 1); base.ErrorType(err) != ErrTypeMergeInputExisted {
+			t.Fatalf("add error[%v] is not expected", err)
+		}
+		// skip the elements merged before all inputs added
+		for i := 0; i != 10; i++ {
+			<-m.Channel()
+		}
+		counts := make(map[string]int)
+		for i := 0; i != 300; i++ {
+			counts[<-m.Channel()]++
+		}
+		for i, name := range names {
+			if n := counts[name]; n < c.expect[i]-3 || n > c.expect[i]+3 {
+				t.Fatalf("strategy[%s] merged count[%d] of input[%s] is not expected", c.strategy, n, name)
+			}
+		}
+		waitFor(func() bool {
+			// the counter is increased after the element received
+			var merged uint64
+			for _, in := range m.Inputs() {
+				merged += in.Merged
+			}
+			return merged == 310
+		})
+		m.Close()
+		for _, q := range inputs {
+			q.Dispose()
+		}
+	}
+}
+
+func TestMergerInputs(t *testing.T) {
+	m := NewMerger[int](WithMergeChannelCapacity(1))
+	a, b := NewBufferOf[int](), NewBufferOf[int]()
+	defer a.Dispose()
+	m.Add("a", a, 1)
+	m.Add("b", b, 1)
+	a.Push(1)
+	if v := <-m.Channel(); v != 1 {
+		t.Fatalf("element[%d] is not expected", v)
+	}
+	if !m.Remove("a") || m.Remove("a") {
+		t.Fatal("remove result is not expected")
+	}
+	// wait for the background goroutine waiting without the input removed
+	time.Sleep(10 * time.Millisecond)
+	a.Push(2)
+	b.Push(3)
+	if v := <-m.Channel(); v != 3 {
+		t.Fatalf("element[%d] is not expected", v)
+	}
+	if v, ok := a.TryPop(); !ok || v != 2 {
+		t.Fatalf("element[%d] of removed input is not expected", v)
+	}
+
+	// the input disposed is removed
+	b.Dispose()
+	waitFor(func() bool {
+		return len(m.Inputs()) == 0
+	})
+
+	c := NewBufferOf[int]()
+	defer c.Dispose()
+	m.Add("c", c, 1)
+	c.Push(4)
+	c.Push(5)
+	waitFor(func() bool {
+		return c.Size() == 0
+	})
+	if vv := m.Close(); len(vv) != 2 || vv[0] != 4 || vv[1] != 5 {
+		t.Fatalf("closed%v is not expected", vv)
+	}
+	if _, ok := <-m.Channel(); ok {
+		t.Fatal("channel is not closed")
+	}
+	if err := m.Add("d", c, 1); base.ErrorType(err) != ErrTypeMergerClosed {
+		t.Fatalf("add error[%v] after Close is not expected", err)
+	}
+	// elements are not moved after Close
+	c.Push(6)
+	time.Sleep(10 * time.Millisecond)
+	if v, ok := c.TryPop(); !ok || v != 6 {
+		t.Fatalf("element[%d] is not expected", v)
+	}
+}
+
+func TestMergerRemoveSelecting(t *testing.T) {
+	m := NewMerger[int]()
+	defer m.Close()
+	a, b := NewBufferOf[int](), NewBufferOf[int]()
+	defer a.Dispose()
+	defer b.Dispose()
+	a.Push(1)
+	b.Push(2)
+	b.Push(3)
+	waitFor(func() bool {
+		return a.ready() && b.ready()
+	})
+	m.Add("a", a, 1)
+	m.Add("b", b, 1)
+	// the element of a is selected and waiting for sending, b is checked but nothing is taken from it
+	waitFor(func() bool {
+		return a.Size() == 0
+	})
+	m.Remove("b")
+	for _, expect := range []int{2, 3} {
+		select {
+		case v := <-b.Channel():
+			if v != expect {
+				t.Fatalf("element[%d] of removed input is not expected[%d]", v, expect)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("element[%d] of removed input is lost", expect)
+		}
+	}
+	if v := <-m.Channel(); v != 1 {
+		t.Fatalf("element[%d] is not expected", v)
+	}
+}
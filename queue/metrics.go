@@ -0,0 +1,239 @@
+package queue
+
+import (
+	"github.com/eapache/queue"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultLatencyBuckets are the upper bounds of latency histogram buckets when WithLatencyBuckets is not set.
+var DefaultLatencyBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// MetricsSink receives the metrics of Buffer when they happen, it's set by WithMetricsSink for exporting them to
+// the monitoring system. The methods are called synchronously without the lock of Buffer held, so they should return quickly.
+type MetricsSink interface {
+	// Pushed is called with the result of every Push, PushWithContext, PushAt and PushKeyed.
+	Pushed(result PushResult)
+
+	// Delivered is called when an element buffered in the self-defined queue is sent to the go chan,
+	// latency is the time since it was pushed, see Stats.QueueLatency.
+	Delivered(latency time.Duration)
+}
+
+// Stats is the snapshot of Buffer metrics returned by Buffer.Stats.
+type Stats struct {
+	// PushedToChan is the count of elements sent to the go chan directly.
+	PushedToChan uint64
+
+	// PushedToQueue is the count of elements inserted to the queue.
+	PushedToQueue uint64
+
+	// Replaced is the count of elements inserted to the queue by PolicyRemove or PolicyClear when the queue is full.
+	Replaced uint64
+
+	// Dropped is the count of elements dropped, including the pushing canceled and after Dispose.
+	Dropped uint64
+
+	// PushedToDelay is the count of elements pushed by PushAt or PushDelayed which wait for the due time.
+	PushedToDelay uint64
+
+	// Coalesced is the count of elements pushed by PushKeyed which replace the element with the same key.
+	Coalesced uint64
+
+	// Length is the count of elements in the self-defined queue in memory, not including the go chan.
+	Length int
+
+	// Spilled is the count of elements spilled to disk, see WithDiskSpill.
+	Spilled int
+
+	// Bytes is the total bytes of elements in the self-defined queue, including the elements spilled to disk, see WithSizer.
+	Bytes int
+
+	// Delayed is the count of elements waiting for the due time, see PushAt.
+	Delayed int
+
+	// HighWater is the max count of elements in the queue ever, including the elements spilled to disk.
+	HighWater int
+
+	// QueueLatency is the histogram of the time the elements wait in the self-defined queue, which is from the element
+	// pushed to the queue to it sent to the go chan. It's the latency of the queue overflowed from the go chan only,
+	// the time waiting in the go chan for receiving is not included, as the go chan is received by the consumer directly.
+	// The elements sent to the go chan directly and recovered from disk are not observed.
+	QueueLatency LatencyHistogram
+}
+
+// LatencyHistogram counts the latencies by buckets.
+type LatencyHistogram struct {
+	// Bounds are the upper bounds of buckets in ascending order.
+	Bounds []time.Duration
+
+	// Counts are the count of latencies in each bucket, a latency is counted in the first bucket which bound is not less than it.
+	// The last one is the count of latencies greater than all bounds, so its length is one more than Bounds.
+	Counts []uint64
+
+	// Count is the count of all latencies observed.
+	Count uint64
+
+	// Sum is the sum of all latencies observed.
+	Sum time.Duration
+}
+
+// WithMetricsSink set the sink for receiving metrics when they happen, see MetricsSink.
+func WithMetricsSink(sink MetricsSink) BufferOption {
+	return func(b *bufferOptions) {
+		b.metrics.sink = sink
+	}
+}
+
+// WithLatencyBuckets set the upper bounds of Stats.QueueLatency histogram buckets in ascending order,
+// the default value is DefaultLatencyBuckets.
+func WithLatencyBuckets(bounds ...time.Duration) BufferOption {
+	return func(b *bufferOptions) {
+		b.metrics.bounds = bounds
+	}
+}
+
+// Stats returns the snapshot of metrics.
+func (b *Buffer[T]) Stats() Stats {
+	m := b.metrics
+	stats := Stats{
+		PushedToChan:  atomic.LoadUint64(&m.results[0]),
+		PushedToQueue: atomic.LoadUint64(&m.results[1]),
+		Replaced:      atomic.LoadUint64(&m.results[2]),
+		Dropped:       atomic.LoadUint64(&m.results[3]),
+		PushedToDelay: atomic.LoadUint64(&m.results[4]),
+		Coalesced:     atomic.LoadUint64(&m.results[5]),
+		QueueLatency: LatencyHistogram{
+			Bounds: append([]time.Duration(nil), m.bounds...),
+			Counts: make([]uint64, len(m.counts)),
+			Count:  atomic.LoadUint64(&m.count),
+			Sum:    time.Duration(atomic.LoadInt64(&m.sum)),
+		},
+	}
+	for n := range m.counts {
+		stats.QueueLatency.Counts[n] = atomic.LoadUint64(&m.counts[n])
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	stats.Length = b.queue.Length() - b.dead
+	if b.spill != nil {
+		stats.Spilled = b.spill.length()
+	}
+	stats.Bytes = b.bytes
+	stats.Delayed = b.delayed.Len()
+	stats.HighWater = m.highWater
+	return stats
+}
+
+// metrics keeps the counters of Buffer. The counters and histogram are updated atomically,
+// others are protected by the lock of Buffer.
+type metrics struct {
+	sink    MetricsSink
+	results [6]uint64
+	bounds  []time.Duration
+	counts  []uint64
+	count   uint64
+	sum     int64
+
+	highWater int
+
+	// stamps are the pushing time of elements in the queue in order, the elements recovered from disk
+	// are before all of them and have no pushing time, unstamped is the count of them.
+	stamps    *queue.Queue
+	unstamped int
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		bounds: DefaultLatencyBuckets,
+		stamps: queue.New(),
+	}
+}
+
+func (m *metrics) init() {
+	m.counts = make([]uint64, len(m.bounds)+1)
+}
+
+func (m *metrics) pushed(ret PushResult) {
+	var n int
+	switch ret {
+	case PushToChan:
+		n = 0
+	case PushToQueue:
+		n = 1
+	case PushToQueueReplace:
+		n = 2
+	case PushToDelay:
+		n = 4
+	case PushCoalesced:
+		n = 5
+	default:
+		n = 3
+	}
+	atomic.AddUint64(&m.results[n], 1)
+	if m.sink != nil {
+		m.sink.Pushed(ret)
+	}
+}
+
+func (m *metrics) delivered(stamp time.Time) {
+	if stamp.IsZero() {
+		return
+	}
+	latency := time.Since(stamp)
+	n := len(m.bounds)
+	for i, bound := range m.bounds {
+		if latency <= bound {
+			n = i
+			break
+		}
+	}
+	atomic.AddUint64(&m.counts[n], 1)
+	atomic.AddUint64(&m.count, 1)
+	atomic.AddInt64(&m.sum, int64(latency))
+	if m.sink != nil {
+		m.sink.Delivered(latency)
+	}
+}
+
+// stamp records the pushing time of the element added and the high-water mark, the caller must hold the lock of Buffer.
+func (m *metrics) stamp(length int) {
+	m.stamps.Add(time.Now())
+	if length > m.highWater {
+		m.highWater = length
+	}
+}
+
+// unstamp removes the pushing time of n elements removed, and returns the last one.
+// The caller must hold the lock of Buffer.
+func (m *metrics) unstamp(n int) time.Time {
+	var stamp time.Time
+	for ; n > 0; n-- {
+		if m.unstamped != 0 {
+			m.unstamped--
+			stamp = time.Time{}
+			continue
+		}
+		if m.stamps.Length() == 0 {
+			break
+		}
+		stamp = m.stamps.Remove().(time.Time)
+	}
+	return stamp
+}
+
+// reset removes all pushing time when the queue is cleared, the caller must hold the lock of Buffer.
+func (m *metrics) reset() {
+	m.stamps = queue.New()
+	m.unstamped = 0
+}
@@ -0,0 +1,80 @@
+package queue
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+type testSink struct {
+	mu        sync.Mutex
+	pushed    map[PushResult]int
+	delivered int
+}
+
+func (s *testSink) Pushed(result PushResult) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pushed[result]++
+}
+
+func (s *testSink) Delivered(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delivered++
+}
+
+func TestStats(t *testing.T) {
+	sink := &testSink{
+		pushed: make(map[PushResult]int),
+	}
+	q := NewBuffer(WithChannelCapacity(2), WithQueueCapacity(4), WithQueuePolicy(PolicyRemove),
+		WithMetricsSink(sink), WithLatencyBuckets(time.Millisecond, time.Hour))
+	for i := 0; i != 10; i++ {
+		q.Push(i)
+	}
+	q.SetCapacity(1)
+	q.Dispose()
+	q.Push(10)
+
+	// the background goroutine may take one element from the queue for sending
+	stats := q.Stats()
+	if stats.PushedToChan != 2 || stats.PushedToQueue+stats.Replaced != 8 || stats.Replaced < 3 || stats.Dropped != 1 {
+		t.Fatalf("push counters are not expected: %+v", stats)
+	}
+	if stats.HighWater != 4 {
+		t.Fatalf("high-water[%d] is not expected", stats.HighWater)
+	}
+	if sink.pushed[PushToChan] != 2 || sink.pushed[PushToQueue] != int(stats.PushedToQueue) ||
+		sink.pushed[PushToQueueReplace] != int(stats.Replaced) || sink.pushed[PushDropped] != 1 {
+		t.Fatalf("sink pushed%v is not expected", sink.pushed)
+	}
+
+	q = NewBuffer(WithChannelCapacity(0), WithMetricsSink(sink), WithLatencyBuckets(time.Millisecond, time.Hour))
+	defer q.Dispose()
+	const num = 5
+	for i := 0; i != num; i++ {
+		q.Push(i)
+	}
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i != num; i++ {
+		<-q.Channel()
+	}
+	// the element sent to the go chan is observed after it's received
+	for q.Stats().QueueLatency.Count != num {
+		time.Sleep(time.Millisecond)
+	}
+	stats = q.Stats()
+	if stats.Length != 0 || stats.HighWater != num {
+		t.Fatalf("length[%d] or high-water[%d] is not expected", stats.Length, stats.HighWater)
+	}
+	latency := stats.QueueLatency
+	if len(latency.Counts) != 3 || latency.Counts[1] != num || latency.Sum < num*10*time.Millisecond {
+		t.Fatalf("latency histogram is not expected: %+v", latency)
+	}
+	sink.mu.Lock()
+	defer sink.mu.Unlock()
+	if sink.delivered != num {
+		t.Fatalf("sink delivered[%d] is not expected", sink.delivered)
+	}
+}
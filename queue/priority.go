@@ -0,0 +1,414 @@
+package queue
+
+import (
+	"context"
+	"github.com/eapache/queue"
+	"github.com/more-infra/base/runner"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// PriorityBuffer is a variant of Buffer with multiple priority levels.
+// Elements are pushed with a priority by Push, and Channel always delivers the element with the highest priority pending,
+// elements with the same priority are delivered in the order of pushing.
+//
+// Each level has its own queue capacity and policy, see WithLevelQueue.
+// Low priority elements may be starved when high priority elements are pushed continuously,
+// WithAging raises the priority of elements by the time they have been waiting for.
+//
+// Elements in the go chan have been delivered already, so the go chan capacity is 0 by default,
+// a greater capacity makes receiving faster but the elements in the go chan could not be overtaken by higher priority elements.
+//
+// PriorityBuffer is typed by the elements T like Buffer, use AnyPriorityBuffer created by NewPriorityBuffer for elements of any type.
+//
+// All methods of PriorityBuffer are thread-safe.
+type PriorityBuffer[T any] struct {
+	priorityOptions
+	runner    *runner.Runner
+	mu        sync.Mutex
+	sign      chan struct{}
+	ch        chan T
+	closed    int32
+	buffering bool
+	pending   int
+	unsent    *T
+}
+
+// AnyPriorityBuffer is the PriorityBuffer of elements with any type.
+type AnyPriorityBuffer = PriorityBuffer[interface{}]
+
+// priorityOptions are the fields of PriorityBuffer defined by PriorityBufferOption.
+type priorityOptions struct {
+	levels     []*priorityLevel
+	chCapacity int
+	aging      time.Duration
+	idleTime   time.Duration
+}
+
+// priorityLevel is the queue of a priority. head is the element taken by the background goroutine but put back
+// for a higher priority element, it's before all elements in queue.
+type priorityLevel struct {
+	queue    *queue.Queue
+	head     *prioritized
+	capacity int
+	policy   Policy
+}
+
+type prioritized struct {
+	elm      interface{}
+	priority int
+	pushed   time.Time
+}
+
+// NewPriorityBuffer creates a PriorityBuffer with levels priorities, the priority of elements is from 0 to levels-1,
+// and the greater is the higher. The options have default value if inputs are not set.
+// The Dispose method is required to call when the PriorityBuffer is not used, or leak of goroutine will be happened.
+func NewPriorityBuffer(levels int, options ...PriorityBufferOption) *AnyPriorityBuffer {
+	return NewPriorityBufferOf[interface{}](levels, options...)
+}
+
+// NewPriorityBufferOf is the same as NewPriorityBuffer, but the PriorityBuffer is typed by the elements T.
+func NewPriorityBufferOf[T any](levels int, options ...PriorityBufferOption) *PriorityBuffer[T] {
+	if levels <= 0 {
+		panic("priority buffer levels must be greater than zero")
+	}
+	b := &PriorityBuffer[T]{
+		priorityOptions: priorityOptions{
+			levels:   make([]*priorityLevel, levels),
+			idleTime: DefaultBufferingIdleTime,
+		},
+		runner: runner.NewRunner(),
+		sign:   make(chan struct{}, 1),
+	}
+	for n := range b.levels {
+		b.levels[n] = &priorityLevel{
+			queue:  queue.New(),
+			policy: PolicyDrop,
+		}
+	}
+	for _, op := range options {
+		op(&b.priorityOptions)
+	}
+	b.ch = make(chan T, b.chCapacity)
+	return b
+}
+
+type PriorityBufferOption func(*priorityOptions)
+
+// WithPriorityChannelCapacity set the channel capacity, this value could not be changed after the PriorityBuffer is created.
+// The default value is 0, so the element is chosen by priority when it's received.
+func WithPriorityChannelCapacity(cap int) PriorityBufferOption {
+	return func(b *priorityOptions) {
+		b.chCapacity = cap
+	}
+}
+
+// WithLevelQueue set the queue capacity and the policy when the queue is full for the level of priority.
+// The capacity could be changed by SetLevelCapacity method. The default value is unlimited capacity with PolicyDrop.
+// PolicyBlock is not supported by PriorityBuffer, it panics with PolicyBlock.
+func WithLevelQueue(priority int, cap int, policy Policy) PriorityBufferOption {
+	if policy == PolicyBlock {
+		panic("priority buffer level queue could not use the queue block policy")
+	}
+	return func(b *priorityOptions) {
+		level := b.levels[b.clamp(priority)]
+		level.capacity = cap
+		level.policy = policy
+	}
+}
+
+// WithAging raises the priority of an element by one level for each period it has been waiting for,
+// so low priority elements will be delivered finally. Elements with the same raised priority are delivered in the order of pushing.
+// The default value 0 means no aging.
+func WithAging(period time.Duration) PriorityBufferOption {
+	return func(b *priorityOptions) {
+		b.aging = period
+	}
+}
+
+// WithPriorityBufferingIdleTime defines the idle time of the background goroutine keeping when the queues are empty.
+// The default value is 10 seconds.
+func WithPriorityBufferingIdleTime(dur time.Duration) PriorityBufferOption {
+	return func(b *priorityOptions) {
+		b.idleTime = dur
+	}
+}
+
+// Push inserts the element with the priority, the priority out of range is limited to the lowest or highest level.
+// After Dispose method is called, the input element will be dropped.
+func (b *PriorityBuffer[T]) Push(elm T, priority int) PushResult {
+	if atomic.CompareAndSwapInt32(&b.closed, 1, 1) {
+		return PushDropped
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if atomic.CompareAndSwapInt32(&b.closed, 1, 1) {
+		return PushDropped
+	}
+	if !b.buffering && b.pending == 0 {
+		// send to channel directly when buffer is empty
+		select {
+		case b.ch <- elm:
+			return PushToChan
+		default:
+		}
+	}
+	priority = b.clamp(priority)
+	level := b.levels[priority]
+	ret := PushToQueue
+	if level.capacity != 0 && level.length() >= level.capacity {
+		// do action by policy when queue is full
+		switch level.policy {
+		case PolicyDrop:
+			return PushDropped
+		case PolicyRemove:
+			level.remove()
+			b.pending--
+			ret = PushToQueueReplace
+		case PolicyClear:
+			b.pending -= level.length()
+			level.head = nil
+			level.queue = queue.New()
+			ret = PushToQueueReplace
+		}
+	}
+	level.queue.Add(&prioritized{
+		elm:      elm,
+		priority: priority,
+		pushed:   time.Now(),
+	})
+	b.pending++
+	if !b.buffering {
+		b.buffering = true
+		b.runner.Mark()
+		go b.running()
+	}
+	select {
+	case b.sign <- struct{}{}:
+	default:
+	}
+	return ret
+}
+
+// Channel return the receiver chan. The chan will be close after Dispose method is called.
+func (b *PriorityBuffer[T]) Channel() <-chan T {
+	return b.ch
+}
+
+// Size returns the count of elements in the PriorityBuffer.
+func (b *PriorityBuffer[T]) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.ch) + b.pending
+}
+
+// LevelSize returns the count of elements pending in the queue of the priority.
+func (b *PriorityBuffer[T]) LevelSize(priority int) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.levels[b.clamp(priority)].length()
+}
+
+// SetLevelCapacity set the queue capacity of the priority dynamically.
+func (b *PriorityBuffer[T]) SetLevelCapacity(priority int, cap int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.levels[b.clamp(priority)].capacity = cap
+}
+
+// Dispose is required to called when the PriorityBuffer is not used.
+// It returns the elements not received, the elements in the go chan are first, and then the pending elements by priority.
+func (b *PriorityBuffer[T]) Dispose() []T {
+	if !atomic.CompareAndSwapInt32(&b.closed, 0, 1) {
+		return nil
+	}
+	b.runner.CloseWait()
+	var vv []T
+	func() {
+		for {
+			select {
+			case v := <-b.ch:
+				vv = append(vv, v)
+			default:
+				return
+			}
+		}
+	}()
+	if b.unsent != nil {
+		vv = append(vv, *b.unsent)
+	}
+	b.mu.Lock()
+	for {
+		p := b.next()
+		if p == nil {
+			break
+		}
+		vv = append(vv, cast[T](p.elm))
+	}
+	b.mu.Unlock()
+	close(b.ch)
+	close(b.sign)
+	return vv
+}
+
+func (b *priorityOptions) clamp(priority int) int {
+	if priority < 0 {
+		return 0
+	}
+	if priority >= len(b.levels) {
+		return len(b.levels) - 1
+	}
+	return priority
+}
+
+// effective returns the priority of the element raised by aging.
+func (b *priorityOptions) effective(p *prioritized, now time.Time) int {
+	if b.aging <= 0 {
+		return p.priority
+	}
+	return b.clamp(p.priority + int(now.Sub(p.pushed)/b.aging))
+}
+
+// before reports whether the element x should be delivered before y, by the effective priority and then the pushing time.
+func (b *priorityOptions) before(x *prioritized, y *prioritized, now time.Time) bool {
+	ex, ey := b.effective(x, now), b.effective(y, now)
+	if ex != ey {
+		return ex > ey
+	}
+	return x.pushed.Before(y.pushed)
+}
+
+// peek returns the level which has the element should be delivered first, the caller must hold the lock.
+func (b *PriorityBuffer[T]) peek() *priorityLevel {
+	var (
+		chosen *priorityLevel
+		now    = time.Now()
+	)
+	for n := len(b.levels) - 1; n >= 0; n-- {
+		level := b.levels[n]
+		p := level.peek()
+		if p == nil {
+			continue
+		}
+		if chosen == nil || b.before(p, chosen.peek(), now) {
+			chosen = level
+		}
+	}
+	return chosen
+}
+
+// next removes the element with the highest effective priority, the caller must hold the lock.
+func (b *PriorityBuffer[T]) next() *prioritized {
+	level := b.peek()
+	if level == nil {
+		return nil
+	}
+	b.pending--
+	return level.remove()
+}
+
+func (b *PriorityBuffer[T]) running() {
+	defer b.runner.Done()
+	for {
+		b.mu.Lock()
+		p := b.next()
+		b.mu.Unlock()
+		if p == nil {
+			// buffer's all element had been consumed
+			var (
+				c      = context.Background()
+				cancel context.CancelFunc
+			)
+			if b.idleTime != 0 {
+				c, cancel = context.WithTimeout(c, b.idleTime)
+			}
+			select {
+			case <-b.runner.Quit():
+				if cancel != nil {
+					cancel()
+				}
+				return
+			case <-b.sign:
+			case <-c.Done():
+			}
+			if cancel != nil {
+				cancel()
+			}
+			b.mu.Lock()
+			p = b.next()
+			if p == nil {
+				b.buffering = false
+			}
+			b.mu.Unlock()
+		}
+		if p == nil {
+			return
+		}
+		if !b.send(p) {
+			return
+		}
+	}
+}
+
+// send sends the element to the channel, it puts the element back when a higher priority element is pushed during sending.
+// It returns false when the PriorityBuffer is disposed.
+func (b *PriorityBuffer[T]) send(p *prioritized) bool {
+	elm := cast[T](p.elm)
+	var tick <-chan time.Time
+	if b.aging > 0 {
+		// the effective priority of pending elements may be raised during sending
+		ticker := time.NewTicker(b.aging)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	for {
+		select {
+		case <-b.runner.Quit():
+			b.unsent = &elm
+			return false
+		case b.ch <- elm:
+			return true
+		case <-b.sign:
+		case <-tick:
+		}
+		b.mu.Lock()
+		level := b.peek()
+		if level != nil && b.before(level.peek(), p, time.Now()) {
+			origin := b.levels[p.priority]
+			if origin.head == nil {
+				origin.head = p
+				b.pending++
+				b.mu.Unlock()
+				return true
+			}
+		}
+		b.mu.Unlock()
+	}
+}
+
+func (l *priorityLevel) length() int {
+	n := l.queue.Length()
+	if l.head != nil {
+		n++
+	}
+	return n
+}
+
+func (l *priorityLevel) peek() *prioritized {
+	if l.head != nil {
+		return l.head
+	}
+	if l.queue.Length() == 0 {
+		return nil
+	}
+	return l.queue.Peek().(*prioritized)
+}
+
+func (l *priorityLevel) remove() *prioritized {
+	if p := l.head; p != nil {
+		l.head = nil
+		return p
+	}
+	return l.queue.Remove().(*prioritized)
+}
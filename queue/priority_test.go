@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPriorityBuffer(t *testing.T) {
+	b := NewPriorityBuffer(3, WithLevelQueue(0, 2, PolicyRemove), WithLevelQueue(2, 1, PolicyDrop))
+	pushes := []struct {
+		elm      int
+		priority int
+		result   PushResult
+	}{
+		{1, 0, PushToQueue},
+		{2, 0, PushToQueue},
+		// the first one of priority 0 is removed
+		{3, 0, PushToQueueReplace},
+		{4, 1, PushToQueue},
+		{5, 5, PushToQueue},
+		{6, 2, PushDropped},
+		{7, -1, PushToQueueReplace},
+		{8, 1, PushToQueue},
+	}
+	for _, p := range pushes {
+		if ret := b.Push(p.elm, p.priority); ret != p.result {
+			t.Fatalf("push element[%d] result[%s] is not expected[%s]", p.elm, ret, p.result)
+		}
+	}
+	if b.Size() != 5 || b.LevelSize(0) != 2 || b.LevelSize(1) != 2 {
+		t.Fatalf("size[%d] is not expected", b.Size())
+	}
+	var received []int
+	for _, expected := range []int{5, 4} {
+		v := <-b.Channel()
+		received = append(received, v.(int))
+		if v.(int) != expected {
+			t.Fatalf("received%v is not expected", received)
+		}
+	}
+	// the higher priority element overtakes the pending ones
+	b.Push(9, 2)
+	time.Sleep(10 * time.Millisecond)
+	for _, expected := range []int{9, 8, 3} {
+		v := <-b.Channel()
+		received = append(received, v.(int))
+		if v.(int) != expected {
+			t.Fatalf("received%v is not expected", received)
+		}
+	}
+	vv := b.Dispose()
+	if len(vv) != 1 || vv[0].(int) != 7 {
+		t.Fatalf("Dispose returns unexpected elements%v", vv)
+	}
+	if b.Push(10, 0) != PushDropped {
+		t.Fatal("push after Dispose is not dropped")
+	}
+}
+
+func TestPriorityBufferAging(t *testing.T) {
+	const aging = 20 * time.Millisecond
+	b := NewPriorityBuffer(3, WithAging(aging))
+	defer b.Dispose()
+	b.Push(0, 0)
+	b.Push(1, 1)
+	time.Sleep(2*aging + aging/2)
+	// the element of priority 0 has been raised to priority 2, and it's pushed before the new one
+	b.Push(2, 2)
+	time.Sleep(10 * time.Millisecond)
+	var received []int
+	for len(received) != 3 {
+		received = append(received, (<-b.Channel()).(int))
+	}
+	if received[0] != 0 || received[1] != 1 || received[2] != 2 {
+		t.Fatalf("received%v is not expected", received)
+	}
+}
+
+func TestPriorityBufferPolicyBlock(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("level queue with block policy does not panic")
+		}
+	}()
+	WithLevelQueue(0, 10, PolicyBlock)
+}
@@ -0,0 +1,151 @@
+package queue
+
+import (
+	"context"
+	"time"
+)
+
+// Pop waits for the next element and removes it from the Buffer, it's the same as receiving from the go chan returned by Channel,
+// except the element held by Peek is returned first.
+// It returns ErrBufferDisposed typed ErrTypeBufferDisposed when the Buffer is disposed, and the error of context when it's done.
+func (b *Buffer[T]) Pop(ctx context.Context) (T, error) {
+	if v, ok := b.startPop(); ok {
+		return v, nil
+	}
+	defer b.endPop()
+	select {
+	case v, ok := <-b.ch:
+		if !ok {
+			return v, errDisposed()
+		}
+		return v, nil
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// TryPop removes the next element without waiting, it returns false when no element is ready.
+// The elements are moved from the queue to the go chan by the background goroutine, so the element being moved
+// or waiting for the rate limit is not ready, even if Size is not 0.
+func (b *Buffer[T]) TryPop() (T, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.peeked != nil {
+		v := *b.peeked
+		b.peeked = nil
+		return v, true
+	}
+	select {
+	case v, ok := <-b.ch:
+		return v, ok
+	default:
+		var zero T
+		return zero, false
+	}
+}
+
+// PopBatch waits for the next element, and then pops more elements until max elements popped or maxWait since the first one.
+// The elements ready are popped at once when maxWait is 0. The elements popped are returned when the context is done
+// or the Buffer is disposed after the first one, the errors are the same as Pop before it.
+func (b *Buffer[T]) PopBatch(ctx context.Context, max int, maxWait time.Duration) ([]T, error) {
+	v, err := b.Pop(ctx)
+	if err != nil {
+		return nil, err
+	}
+	vv := []T{v}
+	var due <-chan time.Time
+	if maxWait > 0 {
+		timer := time.NewTimer(maxWait)
+		defer timer.Stop()
+		due = timer.C
+	}
+	for len(vv) < max {
+		if due == nil {
+			v, ok := b.TryPop()
+			if !ok {
+				break
+			}
+			vv = append(vv, v)
+			continue
+		}
+		v, ok := b.popUntil(ctx, due)
+		if !ok {
+			break
+		}
+		vv = append(vv, v)
+	}
+	return vv, nil
+}
+
+// popUntil waits for the next element as Pop, it returns false when the due is reached, the context is done
+// or the Buffer is disposed.
+func (b *Buffer[T]) popUntil(ctx context.Context, due <-chan time.Time) (T, bool) {
+	if v, ok := b.startPop(); ok {
+		return v, true
+	}
+	defer b.endPop()
+	select {
+	case v, ok := <-b.ch:
+		return v, ok
+	case <-due:
+	case <-ctx.Done():
+	}
+	var zero T
+	return zero, false
+}
+
+// Peek returns the next element without removing it, it returns false when no element is ready as TryPop.
+// The element peeked is held by the Buffer until it's removed by Pop, TryPop or PopBatch,
+// it's not delivered to the go chan anymore, so don't mix Peek with receiving from Channel.
+// It returns false when Pop or PopBatch is waiting, as the next element will be received by them.
+func (b *Buffer[T]) Peek() (T, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.peeked != nil {
+		return *b.peeked, true
+	}
+	if b.popping != 0 {
+		var zero T
+		return zero, false
+	}
+	select {
+	case v, ok := <-b.ch:
+		if ok {
+			b.peeked = &v
+		}
+		return v, ok
+	default:
+		var zero T
+		return zero, false
+	}
+}
+
+// startPop removes the element held by Peek, or marks the Pop waiting when there is none, so Peek could not take the
+// element before the one received by Pop. endPop is required to call after receiving when it returns false.
+func (b *Buffer[T]) startPop() (T, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.peeked != nil {
+		v := *b.peeked
+		b.peeked = nil
+		return v, true
+	}
+	b.popping++
+	var zero T
+	return zero, false
+}
+
+func (b *Buffer[T]) endPop() {
+	b.mu.Lock()
+	b.popping--
+	b.mu.Unlock()
+}
+
+// ready returns true when the next element is ready for TryPop, it doesn't remove the element as Peek does.
+// The element waiting for sending to the go chan without capacity is not ready.
+func (b *Buffer[T]) ready() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.peeked != nil || len(b.ch) != 0
+}
@@ -0,0 +1,144 @@
+package queue
+
+import (
+	"context"
+	"github.com/more-infra/base"
+	"testing"
+	"time"
+)
+
+func TestPop(t *testing.T) {
+	q := NewBufferOf[int](WithChannelCapacity(2))
+	if _, ok := q.TryPop(); ok {
+		t.Fatal("pop from empty buffer")
+	}
+	if _, ok := q.Peek(); ok {
+		t.Fatal("peek from empty buffer")
+	}
+	for i := 0; i != 10; i++ {
+		q.Push(i)
+	}
+	if v, ok := q.Peek(); !ok || v != 0 {
+		t.Fatalf("peek element[%d] is not expected", v)
+	}
+	if v, ok := q.Peek(); !ok || v != 0 {
+		t.Fatalf("peek element[%d] twice is not expected", v)
+	}
+	if v, err := q.Pop(context.Background()); err != nil || v != 0 {
+		t.Fatalf("pop element[%d] is not expected: %v", v, err)
+	}
+	waitFor(func() bool {
+		_, ok := q.Peek()
+		return ok
+	})
+	if v, ok := q.TryPop(); !ok || v != 1 {
+		t.Fatalf("try pop element[%d] is not expected", v)
+	}
+
+	vv, err := q.PopBatch(context.Background(), 5, time.Second)
+	if err != nil || len(vv) != 5 {
+		t.Fatalf("pop batch%v is not expected: %v", vv, err)
+	}
+	for i, v := range vv {
+		if v != i+2 {
+			t.Fatalf("pop batch%v is not expected", vv)
+		}
+	}
+	// only 3 elements left
+	start := time.Now()
+	vv, _ = q.PopBatch(context.Background(), 5, 50*time.Millisecond)
+	if len(vv) != 3 || vv[0] != 7 || vv[2] != 9 {
+		t.Fatalf("pop batch%v is not expected", vv)
+	}
+	if time.Since(start) < 40*time.Millisecond {
+		t.Fatal("pop batch returns before max wait")
+	}
+
+	c, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.Pop(c); err != context.DeadlineExceeded {
+		t.Fatalf("pop error[%v] is not expected", err)
+	}
+	q.Push(10)
+	q.Peek()
+	if vv := q.Dispose(); len(vv) != 1 || vv[0] != 10 {
+		t.Fatalf("disposed%v is not expected", vv)
+	}
+	if _, err := q.Pop(context.Background()); base.ErrorType(err) != ErrTypeBufferDisposed {
+		t.Fatalf("pop error[%v] after Dispose is not expected", err)
+	}
+	if _, err := q.PopBatch(context.Background(), 2, 0); base.ErrorType(err) != ErrTypeBufferDisposed {
+		t.Fatalf("pop batch error[%v] after Dispose is not expected", err)
+	}
+}
+
+func TestPopBatchReady(t *testing.T) {
+	q := NewBufferOf[int]()
+	defer q.Dispose()
+	for i := 0; i != 3; i++ {
+		q.Push(i)
+	}
+	// the elements ready are returned without waiting
+	vv, err := q.PopBatch(context.Background(), 10, 0)
+	if err != nil || len(vv) != 3 {
+		t.Fatalf("pop batch%v is not expected: %v", vv, err)
+	}
+}
+
+func TestPopPeekOrder(t *testing.T) {
+	q := NewBufferOf[int](WithChannelCapacity(4))
+	defer q.Dispose()
+	const count = 2000
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				q.Peek()
+			}
+		}
+	}()
+	go func() {
+		for i := 0; i != count; i++ {
+			q.Push(i)
+		}
+	}()
+	for i := 0; i != count; i++ {
+		var (
+			v   int
+			err error
+		)
+		if i%2 == 0 {
+			v, err = q.Pop(context.Background())
+		} else {
+			var vv []int
+			vv, err = q.PopBatch(context.Background(), 1, time.Millisecond)
+			v = vv[0]
+		}
+		if err != nil || v != i {
+			t.Fatalf("element[%d] is not expected[%d]: %v", v, i, err)
+		}
+	}
+	close(done)
+
+	// Peek does not take the element for the Pop waiting
+	popped := make(chan int)
+	go func() {
+		v, _ := q.Pop(context.Background())
+		popped <- v
+	}()
+	waitFor(func() bool {
+		q.mu.Lock()
+		defer q.mu.Unlock()
+		return q.popping == 1
+	})
+	if _, ok := q.Peek(); ok {
+		t.Fatal("peek while pop is waiting")
+	}
+	q.Push(count)
+	if v := <-popped; v != count {
+		t.Fatalf("element[%d] is not expected[%d]", v, count)
+	}
+}
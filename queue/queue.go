@@ -1,14 +1,29 @@
 package queue
 
 import (
+	"container/heap"
+	"container/list"
 	"context"
+	"errors"
+	"fmt"
 	"github.com/eapache/queue"
+	"github.com/more-infra/base"
 	"github.com/more-infra/base/runner"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+const (
+	ErrTypePushCanceled   = "queue.push_canceled"
+	ErrTypeBufferDisposed = "queue.buffer_disposed"
+)
+
+var (
+	ErrPushCanceled   = errors.New("push is canceled before the element is inserted to the buffer")
+	ErrBufferDisposed = errors.New("buffer has been disposed")
+)
+
 // Buffer provides the channel that capacity can be extended dynamically.
 // When make a channel, the capacity is defined by make function, such as make(chan int, 8),
 // it does not support capacity extending. This package is useful in these scene,
@@ -19,42 +34,138 @@ import (
 // inserted to the self-defined queue struct and then a background goroutine will put the elements in queue into go chan continuously.
 // As you see, the self-defined queue is used for buffering the elements when the go chan is full, and it keeps the order of elements input.
 //
+// Buffer is typed by the elements T, use AnyBuffer created by NewBuffer for elements of any type.
+//
 // All methods of Buffer are thread-safe.
-type Buffer struct {
-	runner        *runner.Runner
-	queue         *queue.Queue
-	mu            sync.Mutex
-	sign          chan struct{}
-	ch            chan interface{}
-	closed        int32
-	buffering     bool
-	chCapacity    int
-	queueCapacity int
-	policy        Policy
-	idleTime      time.Duration
-	unsent        interface{}
+type Buffer[T any] struct {
+	bufferOptions
+	runner    *runner.Runner
+	queue     *queue.Queue
+	mu        sync.Mutex
+	sign      chan struct{}
+	limited   chan struct{}
+	ch        chan T
+	closed    int32
+	buffering bool
+	unsent    *T
+	peeked    *T
+	popping   int
+	waiters   *list.List
+	delayed   *delayHeap[T]
+	keys      map[interface{}]*keyedElement
+	dead      int
+	merge     func(old T, new T) T
+	size      func(elm T) int
+	bytes     int
+}
+
+// AnyBuffer is the Buffer of elements with any type, it's the Buffer before typed.
+type AnyBuffer = Buffer[interface{}]
+
+// waiter is the element waiting for pushing by PolicyBlock, ret and err are set before done is closed.
+type waiter struct {
+	elm  interface{}
+	done chan struct{}
+	ret  PushResult
+	err  error
 }
 
 // NewBuffer create a buffer with the options. The options have default value if inputs are not set.
 // The Dispose method is required to call when the Buffer is not used, or leak of goroutine will be happened.
-func NewBuffer(options ...BufferOption) *Buffer {
-	b := &Buffer{
-		runner:        runner.NewRunner(),
-		queue:         queue.New(),
-		sign:          make(chan struct{}, 1),
-		idleTime:      DefaultBufferingIdleTime,
-		chCapacity:    DefaultChannelCapacity,
-		queueCapacity: 0,
-		policy:        PolicyDrop,
+// It panics when the Buffer could not be opened with WithDiskSpill, use OpenBuffer for getting the error instead.
+func NewBuffer(options ...BufferOption) *AnyBuffer {
+	return NewBufferOf[interface{}](options...)
+}
+
+// NewBufferOf is the same as NewBuffer, but the Buffer is typed by the elements T.
+func NewBufferOf[T any](options ...BufferOption) *Buffer[T] {
+	b, err := OpenBufferOf[T](options...)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+// OpenBuffer is the same as NewBuffer, but it returns the error when the spill dir defined by WithDiskSpill could not be opened,
+// the error is typed ErrTypeSpill. The elements recovered from the dir are delivered by the Buffer at once.
+func OpenBuffer(options ...BufferOption) (*AnyBuffer, error) {
+	return OpenBufferOf[interface{}](options...)
+}
+
+// OpenBufferOf is the same as OpenBuffer, but the Buffer is typed by the elements T.
+// The elements recovered which are not T are skipped.
+func OpenBufferOf[T any](options ...BufferOption) (*Buffer[T], error) {
+	b := &Buffer[T]{
+		bufferOptions: bufferOptions{
+			idleTime:      DefaultBufferingIdleTime,
+			chCapacity:    DefaultChannelCapacity,
+			queueCapacity: 0,
+			policy:        PolicyDrop,
+			metrics:       newMetrics(),
+			limiter:       &tokenBucket{},
+		},
+		runner:  runner.NewRunner(),
+		queue:   queue.New(),
+		sign:    make(chan struct{}, 1),
+		limited: make(chan struct{}, 1),
+		waiters: list.New(),
+		delayed: &delayHeap[T]{},
+		keys:    make(map[interface{}]*keyedElement),
 	}
 	for _, op := range options {
-		op(b)
+		op(&b.bufferOptions)
 	}
-	b.ch = make(chan interface{}, b.chCapacity)
-	return b
+	if merge := b.coalesce.merge; merge != nil {
+		f, ok := merge.(func(T, T) T)
+		if !ok {
+			panic(fmt.Sprintf("coalesce merge function %T does not match the buffer element type", merge))
+		}
+		b.merge = f
+	}
+	b.initSizer()
+	b.ch = make(chan T, b.chCapacity)
+	b.metrics.init()
+	if b.spill != nil {
+		var measure func(elm interface{})
+		if b.size != nil {
+			// the elements recovered are counted as pushing, and subtracted when removing
+			measure = func(elm interface{}) {
+				if v, ok := elm.(T); ok || elm == nil {
+					b.bytes += b.size(v)
+				}
+			}
+		}
+		if err := b.spill.open(measure); err != nil {
+			return nil, err
+		}
+		b.metrics.unstamped = b.spill.length()
+		b.metrics.highWater = b.spill.length()
+		if b.spill.length() != 0 {
+			b.buffering = true
+			b.runner.Mark()
+			go b.running()
+		}
+	}
+	return b, nil
+}
+
+// bufferOptions are the fields of Buffer defined by BufferOption, so the options could be used for Buffer of any type.
+type bufferOptions struct {
+	chCapacity    int
+	queueCapacity int
+	policy        Policy
+	idleTime      time.Duration
+	spill         *spill
+	metrics       *metrics
+	coalesce      coalesceOptions
+	limiter       *tokenBucket
+
+	sizer           interface{}
+	byteCapacity    int
+	maxElementBytes int
 }
 
-type BufferOption func(*Buffer)
+type BufferOption func(*bufferOptions)
 
 const (
 	DefaultChannelCapacity   = 128
@@ -64,7 +175,7 @@ const (
 // WithChannelCapacity set the channel capacity, this value could not be changed after the Buffer is created.
 // The default value is 128.
 func WithChannelCapacity(cap int) BufferOption {
-	return func(b *Buffer) {
+	return func(b *bufferOptions) {
 		b.chCapacity = cap
 	}
 }
@@ -72,7 +183,7 @@ func WithChannelCapacity(cap int) BufferOption {
 // WithQueueCapacity set the self-defined queue capacity, this value could be changed by SetCapacity method.
 // The default value is unlimited, meaning the queue could be always extended when it's required.
 func WithQueueCapacity(cap int) BufferOption {
-	return func(b *Buffer) {
+	return func(b *bufferOptions) {
 		b.queueCapacity = cap
 	}
 }
@@ -80,7 +191,7 @@ func WithQueueCapacity(cap int) BufferOption {
 // WithBufferingIdleTime defines the idle time of the background goroutine keeping when the self-defined queue is empty.
 // The default value is 10 seconds.
 func WithBufferingIdleTime(dur time.Duration) BufferOption {
-	return func(b *Buffer) {
+	return func(b *bufferOptions) {
 		b.idleTime = dur
 	}
 }
@@ -93,81 +204,147 @@ func WithBufferingIdleTime(dur time.Duration) BufferOption {
 //
 // PolicyClear: clear the all queue, and insert element to the new queue.
 //
+// PolicyBlock: wait for the space of queue, see PushWithContext.
+//
 // The default value is PolicyDrop
 func WithQueuePolicy(policy Policy) BufferOption {
-	return func(b *Buffer) {
+	return func(b *bufferOptions) {
 		b.policy = policy
 	}
 }
 
 // Push is input method for Buffer. It's thread-safe.
 // After Dispose method is called, the input element will not be dropped instead of insert.
-func (b *Buffer) Push(elm interface{}) PushResult {
+// With PolicyBlock, it waits until the element is inserted or the Buffer is disposed, see PushWithContext.
+func (b *Buffer[T]) Push(elm T) PushResult {
+	ret, _ := b.PushWithContext(context.Background(), elm)
+	return ret
+}
+
+// PushWithContext is the same as Push, but it could be canceled by the context when it's waiting with PolicyBlock.
+// With PolicyBlock, the element waits for the space of queue when the queue is full,
+// the waiting elements are inserted in the order of calling, and the later one is not inserted before them even if there is space.
+// It returns PushDropped with ErrPushCanceled typed ErrTypePushCanceled when the context is done before the element inserted,
+// and ErrBufferDisposed typed ErrTypeBufferDisposed when the Buffer is disposed.
+// The errors are always nil with other policies, except the Buffer is disposed.
+func (b *Buffer[T]) PushWithContext(ctx context.Context, elm T) (PushResult, error) {
+	ret, err := b.push(ctx, elm, elm)
+	b.metrics.pushed(ret)
+	return ret, err
+}
+
+// push inserts the element, entry is the element or the keyedElement of it stored in the self-defined queue.
+func (b *Buffer[T]) push(ctx context.Context, elm T, entry interface{}) (PushResult, error) {
 	if atomic.CompareAndSwapInt32(&b.closed, 1, 1) {
-		return PushDropped
+		return PushDropped, errDisposed()
 	}
 	b.mu.Lock()
-	defer b.mu.Unlock()
+	ret, el, err := b.pushLocked(elm, entry)
+	b.mu.Unlock()
+	if el == nil {
+		return ret, err
+	}
+	return b.wait(ctx, el)
+}
+
+// pushLocked inserts the element as push, but it returns the waiter in the list when the element waits for the space
+// with PolicyBlock, the caller should release the lock and then wait for it by wait. The caller must hold the lock.
+func (b *Buffer[T]) pushLocked(elm T, entry interface{}) (PushResult, *list.Element, error) {
 	if atomic.CompareAndSwapInt32(&b.closed, 1, 1) {
-		return PushDropped
+		return PushDropped, nil, errDisposed()
+	}
+	if b.oversize(entry) {
+		return PushDropped, nil, nil
 	}
-	if !b.buffering && b.queue.Length() == 0 {
+	if !b.buffering && b.length() == 0 && b.limiter.take() == 0 {
 		// send to channel directly when buffer is empty
 		select {
 		case b.ch <- elm:
-			return PushToChan
+			return PushToChan, nil, nil
 		default:
+			b.limiter.put()
 		}
 	}
-	ret := PushToQueue
-	if b.queueCapacity != 0 && b.queueCapacity == b.queue.Length() {
-		// do action by policy when queue is full
-		switch b.policy {
-		case PolicyDrop:
-			return PushDropped
-		case PolicyRemove:
-			b.queue.Remove()
-			ret = PushToQueueReplace
-		case PolicyClear:
-			b.queue = queue.New()
-			ret = PushToQueueReplace
-		}
+	// the delayed elements due are before the element
+	b.promote()
+	if b.policy != PolicyBlock || b.waiters.Len() == 0 && !b.full(entry) {
+		return b.insert(entry), nil, nil
 	}
-	b.queue.Add(elm)
-	if !b.buffering {
-		b.buffering = true
-		b.runner.Mark()
-		go b.running()
+	return "", b.waiters.PushBack(&waiter{
+		elm:  entry,
+		done: make(chan struct{}),
+	}), nil
+}
+
+// wait waits for the element returned by pushLocked inserted, it's removed from the waiters when the context is done.
+func (b *Buffer[T]) wait(ctx context.Context, el *list.Element) (PushResult, error) {
+	w := el.Value.(*waiter)
+	select {
+	case <-w.done:
+		return w.ret, w.err
+	case <-ctx.Done():
 	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	select {
-	case b.sign <- struct{}{}:
+	case <-w.done:
+		// inserted or disposed before the lock is got
+		return w.ret, w.err
 	default:
 	}
-	return ret
+	b.waiters.Remove(el)
+	return PushDropped, base.NewErrorWithType(ErrTypePushCanceled, ErrPushCanceled).
+		WithMessage(ctx.Err().Error())
 }
 
 // Channel return the receiver chan. The chan will be close after Dispose method is called.
-func (b *Buffer) Channel() <-chan interface{} {
+func (b *Buffer[T]) Channel() <-chan T {
 	return b.ch
 }
 
-func (b *Buffer) Size() int {
-	return len(b.ch) + b.queue.Length()
+// Size returns the count of elements in the Buffer, including the elements spilled to disk, delayed and held by Peek.
+func (b *Buffer[T]) Size() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	n := len(b.ch) + b.length() + b.delayed.Len()
+	if b.peeked != nil {
+		n++
+	}
+	return n
+}
+
+// Policy returns the policy when the queue is full, see WithQueuePolicy.
+func (b *Buffer[T]) Policy() Policy {
+	return b.policy
 }
 
 // SetCapacity set the self-defined queue's capacity dynamically.
-func (b *Buffer) SetCapacity(cap int) {
+func (b *Buffer[T]) SetCapacity(cap int) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 	b.queueCapacity = cap
+	b.admit()
 }
 
 // Dispose is required to called when the Buffer is not used.
-func (b *Buffer) Dispose() []interface{} {
+func (b *Buffer[T]) Dispose() []T {
 	if atomic.CompareAndSwapInt32(&b.closed, 0, 1) {
+		b.mu.Lock()
+		for b.waiters.Len() != 0 {
+			w := b.waiters.Remove(b.waiters.Front()).(*waiter)
+			w.ret, w.err = PushDropped, errDisposed()
+			close(w.done)
+		}
+		b.mu.Unlock()
 		b.runner.CloseWait()
 
-		var vv []interface{}
+		var vv []T
+		b.mu.Lock()
+		if b.peeked != nil {
+			vv = append(vv, *b.peeked)
+			b.peeked = nil
+		}
+		b.mu.Unlock()
 		func() {
 			for {
 				select {
@@ -179,11 +356,18 @@ func (b *Buffer) Dispose() []interface{} {
 			}
 		}()
 		if b.unsent != nil {
-			vv = append(vv, b.unsent)
+			vv = append(vv, *b.unsent)
 		}
 		for b.queue.Length() != 0 {
-			v := b.queue.Remove()
-			vv = append(vv, v)
+			if v, ok := b.unwrap(b.queue.Remove()); ok {
+				vv = append(vv, v)
+			}
+		}
+		for b.delayed.Len() != 0 {
+			vv = append(vv, heap.Pop(b.delayed).(*delayedElement[T]).elm)
+		}
+		if b.spill != nil {
+			b.spill.close()
 		}
 
 		close(b.ch)
@@ -193,57 +377,244 @@ func (b *Buffer) Dispose() []interface{} {
 	return nil
 }
 
-func (b *Buffer) running() {
+func (b *Buffer[T]) running() {
 	defer b.runner.Done()
 	for {
-		var e interface{}
 		b.mu.Lock()
-		if b.queue.Length() != 0 {
-			e = b.queue.Remove()
-		}
+		b.promote()
+		e, ok, stamp := b.remove()
+		b.admit()
+		timer := b.due()
 		b.mu.Unlock()
-		if e == nil {
-			// buffer's all element had been consumed
+		if !ok {
+			// buffer's all element had been consumed, waiting for pushing or the delayed element due
 			var (
 				c      = context.Background()
 				cancel context.CancelFunc
+				due    <-chan time.Time
 			)
 			if b.idleTime != 0 {
 				c, cancel = context.WithTimeout(c, b.idleTime)
 			}
-			select {
-			case <-b.runner.Quit():
+			if timer != nil {
+				due = timer.C
+			}
+			stop := func() {
 				if cancel != nil {
 					cancel()
 				}
+				if timer != nil {
+					timer.Stop()
+				}
+			}
+			select {
+			case <-b.runner.Quit():
+				stop()
 				return
 			case <-b.sign:
 			case <-c.Done():
+			case <-due:
 			}
-			if cancel != nil {
-				cancel()
-			}
+			stop()
 			b.mu.Lock()
-			if b.queue.Length() != 0 {
-				e = b.queue.Remove()
-			} else {
+			b.promote()
+			if b.length() != 0 {
+				e, ok, stamp = b.remove()
+				b.admit()
+			} else if b.delayed.Len() == 0 {
 				b.buffering = false
 			}
+			buffering := b.buffering
 			b.mu.Unlock()
+			if !ok && buffering {
+				continue
+			}
+		} else if timer != nil {
+			timer.Stop()
 		}
-		if e == nil {
+		if !ok {
+			return
+		}
+		if !b.pace() {
+			b.unsent = &e
 			return
 		}
 		// sending element to called channel
 		select {
 		case <-b.runner.Quit():
-			b.unsent = e
+			b.unsent = &e
 			return
 		case b.ch <- e:
+			b.metrics.delivered(stamp)
 		}
 	}
 }
 
+// insert inserts the element by the policy when the queue is full, and wakes the background goroutine up.
+// PolicyBlock is handled by the caller, the element is inserted even if the queue is full. The caller must hold the lock.
+func (b *Buffer[T]) insert(entry interface{}) PushResult {
+	ret := PushToQueue
+	if b.policy != PolicyBlock && b.full(entry) {
+		// do action by policy when queue is full
+		switch b.policy {
+		case PolicyDrop:
+			return PushDropped
+		case PolicyRemove:
+			// more than one element may be removed for the bytes of the element
+			for b.full(entry) && b.length() != 0 {
+				b.remove()
+			}
+			ret = PushToQueueReplace
+		case PolicyClear:
+			b.clear()
+			ret = PushToQueueReplace
+		}
+	}
+	if !b.add(entry) {
+		return PushDropped
+	}
+	b.wake()
+	return ret
+}
+
+// wake starts the background goroutine or wakes it up when it's waiting, the caller must hold the lock.
+func (b *Buffer[T]) wake() {
+	if !b.buffering {
+		b.buffering = true
+		b.runner.Mark()
+		go b.running()
+	}
+	select {
+	case b.sign <- struct{}{}:
+	default:
+	}
+}
+
+// admit inserts the elements waiting by PolicyBlock in order while the queue has space, the caller must hold the lock.
+// The element waiting is dropped when it could never be inserted as the byte capacity is decreased.
+func (b *Buffer[T]) admit() {
+	for b.waiters.Len() != 0 && atomic.LoadInt32(&b.closed) == 0 {
+		w := b.waiters.Front().Value.(*waiter)
+		if b.oversize(w.elm) {
+			w.ret = PushDropped
+		} else if b.full(w.elm) {
+			return
+		} else {
+			w.ret = b.insert(w.elm)
+		}
+		b.waiters.Remove(b.waiters.Front())
+		close(w.done)
+	}
+}
+
+// full returns true when the queue has no space for the entry, the caller must hold the lock.
+func (b *Buffer[T]) full(entry interface{}) bool {
+	if b.queueCapacity != 0 && b.length() >= b.queueCapacity {
+		return true
+	}
+	return b.byteCapacity != 0 && b.bytes+b.sizeOf(entry) > b.byteCapacity
+}
+
+func errDisposed() error {
+	return base.NewErrorWithType(ErrTypeBufferDisposed, ErrBufferDisposed)
+}
+
+// length returns the count of elements in the self-defined queue and spilled to disk, the caller must hold the lock.
+func (b *Buffer[T]) length() int {
+	return b.entries() - b.dead
+}
+
+// entries returns the count of entries in the self-defined queue and spilled to disk, including the keyed elements
+// coalesced to the tail which are skipped when removing. The caller must hold the lock.
+func (b *Buffer[T]) entries() int {
+	n := b.queue.Length()
+	if b.spill != nil {
+		n += b.spill.length()
+	}
+	return n
+}
+
+// add inserts the entry to the tail of the self-defined queue, or spills the element to disk when the memory is full.
+// It returns false when the element could not be spilled. The caller must hold the lock.
+func (b *Buffer[T]) add(entry interface{}) bool {
+	k, keyed := entry.(*keyedElement)
+	if b.spill == nil || b.spill.length() == 0 && b.queue.Length() < b.spill.memory {
+		b.queue.Add(entry)
+		if keyed {
+			b.keys[k.key] = k
+		}
+	} else {
+		elm := entry
+		if keyed {
+			// the element spilled is not coalesced anymore
+			elm = k.elm
+		}
+		if b.spill.push(elm) != nil {
+			return false
+		}
+	}
+	b.bytes += b.sizeOf(entry)
+	b.metrics.stamp(b.length())
+	return true
+}
+
+// remove returns the head element of the self-defined queue, or reads it from disk when the memory is empty.
+// The elements which could not be decoded are skipped, and all elements on disk are dropped when the disk could not be read.
+// It returns false when no elements left, and the pushing time of the element returned. The caller must hold the lock.
+func (b *Buffer[T]) remove() (T, bool, time.Time) {
+	n := b.entries()
+	e, ok := b.take()
+	if ok {
+		b.bytes -= b.sizeOf(e)
+	}
+	if b.entries() == 0 {
+		// the elements on disk dropped are not subtracted
+		b.bytes = 0
+	}
+	return e, ok, b.metrics.unstamp(n - b.entries())
+}
+
+func (b *Buffer[T]) take() (T, bool) {
+	for b.queue.Length() != 0 {
+		if v, ok := b.unwrap(b.queue.Remove()); ok {
+			return v, true
+		}
+	}
+	for b.spill != nil && b.spill.length() != 0 {
+		n := b.spill.length()
+		e, err := b.spill.pop()
+		if err == nil {
+			if v, ok := e.(T); ok || e == nil {
+				return v, true
+			}
+			continue
+		}
+		if b.spill.length() == n {
+			b.spill.reset()
+		}
+	}
+	var zero T
+	return zero, false
+}
+
+// cast converts the element in the self-defined queue to T, the nil element is converted to the zero value of T.
+func cast[T any](v interface{}) T {
+	e, _ := v.(T)
+	return e
+}
+
+// clear removes all elements in the self-defined queue and spilled to disk, the caller must hold the lock.
+func (b *Buffer[T]) clear() {
+	b.queue = queue.New()
+	b.keys = make(map[interface{}]*keyedElement)
+	b.dead = 0
+	b.bytes = 0
+	b.metrics.reset()
+	if b.spill != nil && b.spill.length() != 0 {
+		b.spill.reset()
+	}
+}
+
 type PushResult string
 
 func (r PushResult) String() string {
@@ -255,6 +626,8 @@ const (
 	PushToQueue        PushResult = "push to queue"
 	PushToQueueReplace PushResult = "push to queue replace"
 	PushDropped        PushResult = "push dropped"
+	PushToDelay        PushResult = "push to delay"
+	PushCoalesced      PushResult = "push coalesced"
 )
 
 type Policy string
@@ -267,4 +640,5 @@ const (
 	PolicyDrop   Policy = "drop"
 	PolicyRemove Policy = "remove"
 	PolicyClear  Policy = "clear"
+	PolicyBlock  Policy = "block"
 )
@@ -1,6 +1,8 @@
 package queue
 
 import (
+	"context"
+	"github.com/more-infra/base"
 	"sync"
 	"testing"
 	"time"
@@ -125,3 +127,129 @@ func TestDispose(t *testing.T) {
 		t.Fatalf("Dipose return the elements count[%d] in Buffer is not expected[%d]", len(ee), expected)
 	}
 }
+
+func TestPolicyBlock(t *testing.T) {
+	q := NewBuffer(WithChannelCapacity(1), WithQueueCapacity(2), WithQueuePolicy(PolicyBlock))
+	defer q.Dispose()
+	for q.Size() < 3 {
+		if ret := q.Push(0); ret == PushDropped {
+			t.Fatal("push element is dropped")
+		}
+	}
+
+	// waiters are inserted in the order of calling, one of them may be inserted at once
+	// when the background goroutine takes an element for sending.
+	const waiters = 5
+	var wg sync.WaitGroup
+	inserted := make(chan int, waiters)
+	for i := 0; i != waiters; i++ {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			ret, err := q.PushWithContext(context.Background(), n+1)
+			if err != nil || ret == PushDropped {
+				t.Errorf("push element[%d] failed, result:%s, error:%v", n+1, ret, err)
+			}
+			inserted <- n
+		}(i)
+		waitFor(func() bool {
+			return q.waiting()+len(inserted) == i+1
+		})
+	}
+
+	c, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ret, err := q.PushWithContext(c, -1)
+	if ret != PushDropped || base.ErrorType(err) != ErrTypePushCanceled {
+		t.Fatalf("push with context canceled is not expected, result:%s, error:%v", ret, err)
+	}
+
+	var received []int
+	for len(received) != waiters {
+		if v := (<-q.Channel()).(int); v != 0 {
+			received = append(received, v)
+		}
+	}
+	wg.Wait()
+	for n, v := range received {
+		if v != n+1 {
+			t.Fatalf("received%v is not in the order of pushing", received)
+		}
+	}
+}
+
+func TestPolicyBlockDispose(t *testing.T) {
+	q := NewBuffer(WithChannelCapacity(0), WithQueueCapacity(1), WithQueuePolicy(PolicyBlock))
+	done := make(chan error, 2)
+	push := func() {
+		_, err := q.PushWithContext(context.Background(), 0)
+		done <- err
+	}
+	// the first element may be taken by the background goroutine, and the second one may be inserted by it
+	for i := 0; i != 3; i++ {
+		go push()
+		waitFor(func() bool {
+			return q.waiting() != 0 || len(done) != 0
+		})
+		if q.waiting() != 0 {
+			break
+		}
+		if err := <-done; err != nil {
+			t.Fatalf("push failed: %v", err)
+		}
+	}
+	q.Dispose()
+	if err := <-done; base.ErrorType(err) != ErrTypeBufferDisposed {
+		t.Fatalf("error[%v] is not expected", err)
+	}
+	if _, err := q.PushWithContext(context.Background(), 0); base.ErrorType(err) != ErrTypeBufferDisposed {
+		t.Fatalf("error[%v] is not expected", err)
+	}
+}
+
+func (b *Buffer[T]) waiting() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.waiters.Len()
+}
+
+func waitFor(f func() bool) {
+	for !f() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestBufferOf(t *testing.T) {
+	type item struct {
+		n int
+	}
+	q := NewBufferOf[*item](WithChannelCapacity(1))
+	for i := 0; i != 10; i++ {
+		q.Push(&item{n: i})
+	}
+	if v := <-q.Channel(); v.n != 0 {
+		t.Fatalf("element[%d] is not expected", v.n)
+	}
+	vv := q.Dispose()
+	// the element taken by the background goroutine is returned by Dispose too
+	if len(vv) != 9 {
+		t.Fatalf("disposed count[%d] is not expected", len(vv))
+	}
+	for n, v := range vv {
+		if v.n != n+1 {
+			t.Fatalf("disposed element[%d] is not expected[%d]", v.n, n+1)
+		}
+	}
+
+	// nil elements are delivered as they are
+	b := NewBuffer(WithChannelCapacity(0))
+	defer b.Dispose()
+	b.Push(nil)
+	b.Push(1)
+	if v := <-b.Channel(); v != nil {
+		t.Fatalf("element[%v] is not nil", v)
+	}
+	if v := <-b.Channel(); v != 1 {
+		t.Fatalf("element[%v] is not expected", v)
+	}
+}
@@ -0,0 +1,83 @@
+package queue
+
+import "fmt"
+
+// WithSizer defines the function returning the size in bytes of the element, it's required by WithByteCapacity and WithMaxElementBytes.
+// The size of the same element must be the same at any time, it's called with the lock of Buffer held, so it should return quickly.
+// T must be the element type of the Buffer, or creating the Buffer will panic.
+func WithSizer[T any](sizer func(elm T) int) BufferOption {
+	return func(b *bufferOptions) {
+		b.sizer = sizer
+	}
+}
+
+// WithByteCapacity set the capacity of the self-defined queue by the total bytes of elements, including the elements spilled to disk.
+// The policy is applied when the element pushed exceeds it as the queue is full, and the elements larger than it are always dropped.
+// It works with WithQueueCapacity together, the queue is full when either of them reached.
+// The elements in the go chan and delayed are not counted, and the elements recovered from disk are decoded for counting when opening.
+// This value could be changed by SetByteCapacity method.
+// The default value is unlimited.
+func WithByteCapacity(cap int) BufferOption {
+	return func(b *bufferOptions) {
+		b.byteCapacity = cap
+	}
+}
+
+// WithMaxElementBytes defines the max size in bytes of an element, the larger elements are dropped when pushing,
+// even if the go chan is not full. The default value is unlimited.
+func WithMaxElementBytes(max int) BufferOption {
+	return func(b *bufferOptions) {
+		b.maxElementBytes = max
+	}
+}
+
+// SetByteCapacity set the capacity of the self-defined queue by the total bytes dynamically.
+// The elements in the queue are kept when it's less than the bytes of them.
+func (b *Buffer[T]) SetByteCapacity(cap int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.byteCapacity = cap
+	b.admit()
+}
+
+// Bytes returns the total bytes of elements in the self-defined queue, including the elements spilled to disk.
+// It's always 0 when WithSizer is not set.
+func (b *Buffer[T]) Bytes() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.bytes
+}
+
+func (b *Buffer[T]) initSizer() {
+	if b.sizer == nil {
+		if b.byteCapacity != 0 || b.maxElementBytes != 0 {
+			panic("buffer byte capacity is set without sizer")
+		}
+		return
+	}
+	f, ok := b.sizer.(func(T) int)
+	if !ok {
+		panic(fmt.Sprintf("sizer function %T does not match the buffer element type", b.sizer))
+	}
+	b.size = f
+}
+
+// sizeOf returns the size of the entry in the self-defined queue, the caller must hold the lock.
+func (b *Buffer[T]) sizeOf(entry interface{}) int {
+	if b.size == nil {
+		return 0
+	}
+	if k, ok := entry.(*keyedElement); ok {
+		entry = k.elm
+	}
+	return b.size(cast[T](entry))
+}
+
+// oversize returns true when the element could never be inserted to the queue, the caller must hold the lock.
+func (b *Buffer[T]) oversize(entry interface{}) bool {
+	if b.size == nil {
+		return false
+	}
+	n := b.sizeOf(entry)
+	return b.maxElementBytes != 0 && n > b.maxElementBytes || b.byteCapacity != 0 && n > b.byteCapacity
+}
@@ -0,0 +1,186 @@
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestByteCapacity(t *testing.T) {
+	sizer := func(elm []byte) int {
+		return len(elm)
+	}
+	for _, c := range []struct {
+		policy Policy
+		expect []int
+		bytes  int
+	}{
+		{PolicyDrop, []int{4, 4}, 8},
+		{PolicyRemove, []int{4, 6}, 10},
+		{PolicyClear, []int{6}, 6},
+	} {
+		q := NewBufferOf[[]byte](WithChannelCapacity(0), WithSizer(sizer), WithByteCapacity(10),
+			WithMaxElementBytes(8), WithQueuePolicy(c.policy))
+		q.Push(make([]byte, 4))
+		q.Push(make([]byte, 4))
+		if ret := q.Push(make([]byte, 9)); ret != PushDropped {
+			t.Fatalf("push result[%s] of element larger than max is not expected", ret)
+		}
+		q.Push(make([]byte, 6))
+		if n := q.Bytes(); n != c.bytes {
+			t.Fatalf("policy[%s] bytes[%d] is not expected", c.policy, n)
+		}
+		if stats := q.Stats(); stats.Bytes != c.bytes {
+			t.Fatalf("policy[%s] stats bytes[%d] is not expected", c.policy, stats.Bytes)
+		}
+		vv := q.Dispose()
+		if len(vv) != len(c.expect) {
+			t.Fatalf("policy[%s] disposed elements count[%d] is not expected", c.policy, len(vv))
+		}
+		for i, v := range vv {
+			if len(v) != c.expect[i] {
+				t.Fatalf("policy[%s] disposed element[%d] size[%d] is not expected", c.policy, i, len(v))
+			}
+		}
+	}
+}
+
+func TestByteCapacityBlock(t *testing.T) {
+	q := NewBufferOf[string](WithChannelCapacity(0), WithQueuePolicy(PolicyBlock), WithByteCapacity(5),
+		WithSizer(func(elm string) int {
+			return len(elm)
+		}))
+	defer q.Dispose()
+	q.Push("abc")
+	waitFor(func() bool {
+		// the head element is held by the background goroutine
+		return q.Bytes() == 0
+	})
+	q.Push("abc")
+	c, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if ret, _ := q.PushWithContext(c, "abc"); ret != PushDropped {
+		t.Fatalf("push result[%s] is not expected", ret)
+	}
+
+	done := make(chan PushResult)
+	go func() {
+		done <- q.Push("def")
+	}()
+	waitFor(func() bool {
+		return q.waiting() == 1
+	})
+	q.SetByteCapacity(6)
+	if ret := <-done; ret != PushToQueue {
+		t.Fatalf("push result[%s] is not expected", ret)
+	}
+	for _, expect := range []string{"abc", "abc", "def"} {
+		if v := <-q.Channel(); v != expect {
+			t.Fatalf("element[%s] is not expected[%s]", v, expect)
+		}
+	}
+	waitFor(func() bool {
+		return q.Bytes() == 0
+	})
+}
+
+func TestByteCapacityCoalesce(t *testing.T) {
+	q := NewBufferOf[string](WithChannelCapacity(0), WithSizer(func(elm string) int {
+		return len(elm)
+	}))
+	defer q.Dispose()
+	q.PushKeyed("a", "x")
+	q.PushKeyed("b", "y")
+	q.PushKeyed("b", "yyyy")
+	waitFor(func() bool {
+		return q.Bytes() == 4
+	})
+}
+
+func TestByteCapacityCoalesceMerge(t *testing.T) {
+	for _, c := range []struct {
+		policy Policy
+		ret    PushResult
+		bytes  int
+		expect []string
+	}{
+		{PolicyDrop, PushDropped, 4, []string{"h", "xx", "yy"}},
+		{PolicyRemove, PushToQueueReplace, 5, []string{"h", "xxzzz"}},
+		{PolicyClear, PushToQueueReplace, 5, []string{"h", "xxzzz"}},
+	} {
+		q := NewBufferOf[string](WithChannelCapacity(0), WithQueuePolicy(c.policy), WithByteCapacity(6),
+			WithSizer(func(elm string) int {
+				return len(elm)
+			}),
+			WithCoalesceMerge(func(old string, new string) string {
+				return old + new
+			}))
+		q.Push("h")
+		waitFor(func() bool {
+			// the head element is held by the background goroutine
+			return q.Bytes() == 0
+		})
+		q.PushKeyed("a", "xx")
+		q.PushKeyed("b", "yy")
+		// the merged element exceeds the byte capacity
+		if ret := q.PushKeyed("a", "zzz"); ret != c.ret {
+			t.Fatalf("policy[%s] push result[%s] is not expected", c.policy, ret)
+		}
+		if n := q.Bytes(); n != c.bytes {
+			t.Fatalf("policy[%s] bytes[%d] is not expected", c.policy, n)
+		}
+		for _, expect := range c.expect {
+			if v := <-q.Channel(); v != expect {
+				t.Fatalf("policy[%s] element[%s] is not expected[%s]", c.policy, v, expect)
+			}
+		}
+		waitFor(func() bool {
+			return q.Bytes() == 0
+		})
+		q.Dispose()
+	}
+}
+
+func TestByteCapacityRecovery(t *testing.T) {
+	dir := t.TempDir()
+	options := []BufferOption{WithChannelCapacity(0), WithDiskSpill(dir, 0, BytesCodec{}), WithByteCapacity(100),
+		WithSizer(func(elm []byte) int {
+			return len(elm)
+		})}
+	q, err := OpenBufferOf[[]byte](options...)
+	if err != nil {
+		t.Fatalf("OpenBufferOf failed: %v", err)
+	}
+	for i := 0; i != 5; i++ {
+		q.Push(make([]byte, 10))
+	}
+	// the element held by the background goroutine is returned, others are kept on disk
+	if vv := q.Dispose(); len(vv) != 1 {
+		t.Fatalf("disposed elements count[%d] is not expected", len(vv))
+	}
+
+	q, err = OpenBufferOf[[]byte](options...)
+	if err != nil {
+		t.Fatalf("OpenBufferOf failed: %v", err)
+	}
+	defer q.Dispose()
+	if n := q.Bytes(); n != 40 && n != 30 {
+		t.Fatalf("recovered bytes[%d] is not expected", n)
+	}
+	<-q.Channel()
+	<-q.Channel()
+	waitFor(func() bool {
+		return q.Size() == 1
+	})
+	if n := q.Bytes(); n != 10 {
+		t.Fatalf("bytes[%d] is not expected", n)
+	}
+	for i := 0; i != 9; i++ {
+		if ret := q.Push(make([]byte, 10)); ret == PushDropped {
+			t.Fatalf("push element[%d] is dropped", i)
+		}
+	}
+	if ret := q.Push(make([]byte, 10)); ret != PushDropped {
+		t.Fatalf("push result[%s] exceeding the byte capacity is not expected", ret)
+	}
+}
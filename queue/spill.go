@@ -0,0 +1,469 @@
+package queue
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"github.com/more-infra/base"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ErrTypeSpill = "queue.spill"
+)
+
+var (
+	ErrSpillCorrupted = errors.New("spill segment file is corrupted")
+)
+
+// Codec serializes the elements spilled to disk, see WithDiskSpill.
+type Codec interface {
+	Encode(elm interface{}) ([]byte, error)
+	Decode(data []byte) (interface{}, error)
+}
+
+// GobCodec encodes elements by encoding/gob, the concrete types of elements must be registered by gob.Register.
+type GobCodec struct{}
+
+type gobElement struct {
+	Element interface{}
+}
+
+func (GobCodec) Encode(elm interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(&gobElement{Element: elm}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (GobCodec) Decode(data []byte) (interface{}, error) {
+	var e gobElement
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&e); err != nil {
+		return nil, err
+	}
+	return e.Element, nil
+}
+
+// BytesCodec is the Codec for elements which are []byte, they are saved as they are.
+type BytesCodec struct{}
+
+func (BytesCodec) Encode(elm interface{}) ([]byte, error) {
+	data, ok := elm.([]byte)
+	if !ok {
+		return nil, fmt.Errorf("element type %T is not []byte", elm)
+	}
+	return data, nil
+}
+
+func (BytesCodec) Decode(data []byte) (interface{}, error) {
+	return data, nil
+}
+
+// SyncPolicy defines when the spilled data is flushed to the disk by fsync.
+type SyncPolicy string
+
+func (p SyncPolicy) String() string {
+	return string(p)
+}
+
+const (
+	// SyncNever leaves the flushing to the operating system, it's the fastest, but the data may be lost when the system crashes.
+	SyncNever SyncPolicy = "never"
+
+	// SyncAlways flushes the data after every element spilled or consumed.
+	SyncAlways SyncPolicy = "always"
+
+	// SyncInterval flushes the data when the interval set by WithSyncInterval passed since the last flushing.
+	SyncInterval SyncPolicy = "interval"
+)
+
+const (
+	DefaultSegmentSize  = 64 << 20
+	DefaultSyncInterval = time.Second
+
+	spillSegmentPrefix = "segment-"
+	spillSegmentSuffix = ".log"
+	spillCheckpoint    = "checkpoint"
+	spillRecordHeader  = 8
+)
+
+type SpillOption func(*spill)
+
+// WithSegmentSize defines the max bytes of a segment file, a new segment file is created when it's exceeded.
+// The segment file is deleted when all elements in it are consumed. The default value is 64MB.
+func WithSegmentSize(size int64) SpillOption {
+	return func(s *spill) {
+		s.segmentSize = size
+	}
+}
+
+// WithSyncPolicy defines when the spilled data is flushed to the disk, the default value is SyncNever.
+func WithSyncPolicy(policy SyncPolicy) SpillOption {
+	return func(s *spill) {
+		s.syncPolicy = policy
+	}
+}
+
+// WithSyncInterval defines the interval of SyncInterval policy, the default value is 1 second.
+func WithSyncInterval(interval time.Duration) SpillOption {
+	return func(s *spill) {
+		s.syncInterval = interval
+	}
+}
+
+// WithDiskSpill makes the Buffer keep at most memory elements in the self-defined queue,
+// the elements beyond it are serialized by the codec and saved to segment files in the dir, and read back in order.
+// The elements in the dir which are not consumed are recovered when the Buffer is created with the same dir next time,
+// they are delivered before the elements pushed later. Set memory to 0 for saving all buffering elements to the dir.
+// Only one Buffer could use the dir at the same time.
+//
+// The queue capacity and policy are applied to the total count of elements in memory and in the dir.
+// Dispose returns the elements in memory, and keeps the elements in the dir for recovering.
+// Elements which could not be decoded are skipped.
+func WithDiskSpill(dir string, memory int, codec Codec, options ...SpillOption) BufferOption {
+	return func(b *bufferOptions) {
+		s := &spill{
+			dir:          dir,
+			memory:       memory,
+			codec:        codec,
+			segmentSize:  DefaultSegmentSize,
+			syncPolicy:   SyncNever,
+			syncInterval: DefaultSyncInterval,
+		}
+		for _, op := range options {
+			op(s)
+		}
+		b.spill = s
+	}
+}
+
+// spill saves elements to segment files in order. Each record in segment file is a 4 bytes length and a 4 bytes crc32
+// of the data in big endian, following by the data encoded by codec. The checkpoint file saves the segment id and offset of
+// the first element not consumed. All methods are called with the lock of Buffer held.
+type spill struct {
+	dir          string
+	memory       int
+	codec        Codec
+	segmentSize  int64
+	syncPolicy   SyncPolicy
+	syncInterval time.Duration
+	lastSync     time.Time
+
+	checkpoint   *os.File
+	writer       *os.File
+	writerId     uint64
+	writerSize   int64
+	reader       *os.File
+	readerId     uint64
+	readerOffset int64
+	count        int
+}
+
+func (s *spill) errSpill(err error, op string) error {
+	return base.NewErrorWithType(ErrTypeSpill, err).
+		WithField("dir", s.dir).
+		WithField("op", op)
+}
+
+// open recovers the elements not consumed in the dir, measure is called with each element recovered when it's not nil.
+func (s *spill) open(measure func(elm interface{})) error {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return s.errSpill(err, "mkdir")
+	}
+	ids, err := s.segments()
+	if err != nil {
+		return s.errSpill(err, "list")
+	}
+	s.checkpoint, err = os.OpenFile(filepath.Join(s.dir, spillCheckpoint), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return s.errSpill(err, "open checkpoint")
+	}
+	var pos [16]byte
+	if n, _ := s.checkpoint.ReadAt(pos[:], 0); n == len(pos) {
+		s.readerId = binary.BigEndian.Uint64(pos[:8])
+		s.readerOffset = int64(binary.BigEndian.Uint64(pos[8:]))
+	}
+	// delete the segments consumed
+	for len(ids) != 0 && ids[0] < s.readerId {
+		if err := os.Remove(s.segmentPath(ids[0])); err != nil {
+			return s.errSpill(err, "remove")
+		}
+		ids = ids[1:]
+	}
+	if len(ids) == 0 || ids[0] != s.readerId {
+		s.readerOffset = 0
+		if len(ids) != 0 {
+			s.readerId = ids[0]
+		}
+	}
+	// count the records and truncate the broken tail of the last segment
+	for n, id := range ids {
+		var offset int64
+		if id == s.readerId {
+			offset = s.readerOffset
+		}
+		count, end, err := s.scan(id, offset, measure)
+		if err != nil {
+			return s.errSpill(err, "scan")
+		}
+		s.count += count
+		if n == len(ids)-1 {
+			if err := os.Truncate(s.segmentPath(id), end); err != nil {
+				return s.errSpill(err, "truncate")
+			}
+			s.writerId, s.writerSize = id, end
+		}
+	}
+	if len(ids) == 0 {
+		s.writerId = s.readerId
+	}
+	if s.writer, err = os.OpenFile(s.segmentPath(s.writerId), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+		return s.errSpill(err, "open segment")
+	}
+	if s.reader, err = os.Open(s.segmentPath(s.readerId)); err != nil {
+		return s.errSpill(err, "open segment")
+	}
+	return s.saveCheckpoint()
+}
+
+func (s *spill) segmentPath(id uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%s%020d%s", spillSegmentPrefix, id, spillSegmentSuffix))
+}
+
+// segments returns the ids of segment files in ascending order.
+func (s *spill) segments() ([]uint64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, err
+	}
+	var ids []uint64
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, spillSegmentPrefix) || !strings.HasSuffix(name, spillSegmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, spillSegmentPrefix), spillSegmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i] < ids[j]
+	})
+	return ids, nil
+}
+
+// scan counts the complete records in the segment from the offset, it returns the count and the end offset of them.
+// The records are decoded and passed to measure when it's not nil, the ones could not be decoded are skipped.
+func (s *spill) scan(id uint64, offset int64, measure func(elm interface{})) (int, int64, error) {
+	f, err := os.Open(s.segmentPath(id))
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	var count int
+	for {
+		var header [spillRecordHeader]byte
+		if _, err := f.ReadAt(header[:], offset); err != nil {
+			return count, offset, nil
+		}
+		end := offset + spillRecordHeader + int64(binary.BigEndian.Uint32(header[:4]))
+		if end > info.Size() {
+			return count, offset, nil
+		}
+		if measure != nil {
+			data := make([]byte, end-offset-spillRecordHeader)
+			if _, err := f.ReadAt(data, offset+spillRecordHeader); err != nil {
+				return count, offset, nil
+			}
+			if crc32.ChecksumIEEE(data) == binary.BigEndian.Uint32(header[4:8]) {
+				if elm, err := s.codec.Decode(data); err == nil {
+					measure(elm)
+				}
+			}
+		}
+		count++
+		offset = end
+	}
+}
+
+func (s *spill) length() int {
+	return s.count
+}
+
+// push appends the element to the last segment.
+func (s *spill) push(elm interface{}) error {
+	data, err := s.codec.Encode(elm)
+	if err != nil {
+		return s.errSpill(err, "encode")
+	}
+	if s.writerSize != 0 && s.writerSize+spillRecordHeader+int64(len(data)) > s.segmentSize {
+		if err := s.roll(); err != nil {
+			return err
+		}
+	}
+	record := make([]byte, spillRecordHeader+len(data))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(data))
+	copy(record[spillRecordHeader:], data)
+	if _, err := s.writer.Write(record); err != nil {
+		return s.errSpill(err, "write")
+	}
+	s.writerSize += int64(len(record))
+	s.count++
+	if s.needSync() {
+		if err := s.writer.Sync(); err != nil {
+			return s.errSpill(err, "sync")
+		}
+	}
+	return nil
+}
+
+// roll creates a new segment for writing.
+func (s *spill) roll() error {
+	if err := s.writer.Close(); err != nil {
+		return s.errSpill(err, "close segment")
+	}
+	s.writerId++
+	s.writerSize = 0
+	var err error
+	if s.writer, err = os.OpenFile(s.segmentPath(s.writerId), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+		return s.errSpill(err, "open segment")
+	}
+	return nil
+}
+
+// pop reads the first element not consumed, the element is consumed even if it could not be decoded.
+func (s *spill) pop() (interface{}, error) {
+	if s.count == 0 {
+		return nil, nil
+	}
+	for {
+		var header [spillRecordHeader]byte
+		_, err := s.reader.ReadAt(header[:], s.readerOffset)
+		if err == io.EOF && s.readerId != s.writerId {
+			// the segment is consumed completely
+			if err := s.next(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err != nil {
+			return nil, s.errSpill(err, "read")
+		}
+		data := make([]byte, binary.BigEndian.Uint32(header[:4]))
+		if _, err := s.reader.ReadAt(data, s.readerOffset+spillRecordHeader); err != nil {
+			return nil, s.errSpill(err, "read")
+		}
+		s.readerOffset += spillRecordHeader + int64(len(data))
+		s.count--
+		if s.count == 0 {
+			err = s.reset()
+		} else {
+			err = s.saveCheckpoint()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:8]) {
+			return nil, s.errSpill(ErrSpillCorrupted, "read")
+		}
+		elm, err := s.codec.Decode(data)
+		if err != nil {
+			return nil, s.errSpill(err, "decode")
+		}
+		return elm, nil
+	}
+}
+
+// next deletes the segment consumed and moves the reader to the next segment.
+func (s *spill) next() error {
+	s.reader.Close()
+	if err := os.Remove(s.segmentPath(s.readerId)); err != nil {
+		return s.errSpill(err, "remove")
+	}
+	s.readerId++
+	s.readerOffset = 0
+	var err error
+	if s.reader, err = os.Open(s.segmentPath(s.readerId)); err != nil {
+		return s.errSpill(err, "open segment")
+	}
+	return s.saveCheckpoint()
+}
+
+// reset deletes all segments and starts a new segment when all elements are consumed.
+func (s *spill) reset() error {
+	s.reader.Close()
+	s.writer.Close()
+	for id := s.readerId; id <= s.writerId; id++ {
+		if err := os.Remove(s.segmentPath(id)); err != nil && !os.IsNotExist(err) {
+			return s.errSpill(err, "remove")
+		}
+	}
+	s.count = 0
+	s.writerId++
+	s.writerSize = 0
+	s.readerId = s.writerId
+	s.readerOffset = 0
+	var err error
+	if s.writer, err = os.OpenFile(s.segmentPath(s.writerId), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644); err != nil {
+		return s.errSpill(err, "open segment")
+	}
+	if s.reader, err = os.Open(s.segmentPath(s.readerId)); err != nil {
+		return s.errSpill(err, "open segment")
+	}
+	return s.saveCheckpoint()
+}
+
+func (s *spill) saveCheckpoint() error {
+	var pos [16]byte
+	binary.BigEndian.PutUint64(pos[:8], s.readerId)
+	binary.BigEndian.PutUint64(pos[8:], uint64(s.readerOffset))
+	if _, err := s.checkpoint.WriteAt(pos[:], 0); err != nil {
+		return s.errSpill(err, "write checkpoint")
+	}
+	if s.needSync() {
+		if err := s.checkpoint.Sync(); err != nil {
+			return s.errSpill(err, "sync")
+		}
+	}
+	return nil
+}
+
+func (s *spill) needSync() bool {
+	switch s.syncPolicy {
+	case SyncAlways:
+		return true
+	case SyncInterval:
+		if now := time.Now(); now.Sub(s.lastSync) >= s.syncInterval {
+			s.lastSync = now
+			return true
+		}
+	}
+	return false
+}
+
+func (s *spill) close() {
+	if s.syncPolicy != SyncNever {
+		s.writer.Sync()
+		s.checkpoint.Sync()
+	}
+	s.writer.Close()
+	s.reader.Close()
+	s.checkpoint.Close()
+}
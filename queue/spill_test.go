@@ -0,0 +1,136 @@
+package queue
+
+import (
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type spillElement struct {
+	Id   int
+	Name string
+}
+
+func init() {
+	gob.Register(&spillElement{})
+}
+
+func TestDiskSpill(t *testing.T) {
+	dir := t.TempDir()
+	const num = 100
+	b, err := OpenBuffer(WithChannelCapacity(1), WithDiskSpill(dir, 10, GobCodec{}, WithSegmentSize(256), WithSyncPolicy(SyncAlways)))
+	if err != nil {
+		t.Fatalf("OpenBuffer failed: %v", err)
+	}
+	for i := 0; i != num; i++ {
+		if ret := b.Push(&spillElement{Id: i}); ret == PushDropped {
+			t.Fatalf("push element[%d] is dropped", i)
+		}
+	}
+	// the element taken by the background goroutine for sending is not counted
+	if size := b.Size(); size != num && size != num-1 {
+		t.Fatalf("size[%d] is not expected[%d]", size, num)
+	}
+	segments, _ := filepath.Glob(filepath.Join(dir, spillSegmentPrefix+"*"))
+	if len(segments) < 2 {
+		t.Fatalf("segments%v are not rolled", segments)
+	}
+	for i := 0; i != num/2; i++ {
+		v := <-b.Channel()
+		if v.(*spillElement).Id != i {
+			t.Fatalf("element[%d] is not expected[%d]", v.(*spillElement).Id, i)
+		}
+	}
+	vv := b.Dispose()
+
+	// the elements in memory are returned by Dispose, others are recovered
+	b, err = OpenBuffer(WithDiskSpill(dir, 10, GobCodec{}))
+	if err != nil {
+		t.Fatalf("OpenBuffer failed: %v", err)
+	}
+	if b.Size()+len(vv) != num/2 {
+		t.Fatalf("recovered size[%d] and disposed[%d] are not expected", b.Size(), len(vv))
+	}
+	next := num - b.Size()
+	b.Push(&spillElement{Id: num})
+	for i := next; i != num+1; i++ {
+		v := <-b.Channel()
+		if v.(*spillElement).Id != i {
+			t.Fatalf("element[%d] is not expected[%d]", v.(*spillElement).Id, i)
+		}
+	}
+	b.Dispose()
+	segments, _ = filepath.Glob(filepath.Join(dir, spillSegmentPrefix+"*"))
+	if len(segments) != 1 {
+		t.Fatalf("segments%v consumed are not deleted", segments)
+	}
+}
+
+func TestDiskSpillRecovery(t *testing.T) {
+	dir := t.TempDir()
+	b, err := OpenBuffer(WithChannelCapacity(1), WithDiskSpill(dir, 0, BytesCodec{}))
+	if err != nil {
+		t.Fatalf("OpenBuffer failed: %v", err)
+	}
+	for _, s := range []string{"a", "b", "c", "d", "e"} {
+		b.Push([]byte(s))
+	}
+	if v := <-b.Channel(); string(v.([]byte)) != "a" {
+		t.Fatalf("element[%s] is not expected", v)
+	}
+	var received []string
+	for _, v := range b.Dispose() {
+		received = append(received, string(v.([]byte)))
+	}
+
+	// a broken record at the tail is truncated
+	segments, _ := filepath.Glob(filepath.Join(dir, spillSegmentPrefix+"*"))
+	f, _ := os.OpenFile(segments[len(segments)-1], os.O_WRONLY|os.O_APPEND, 0644)
+	f.Write([]byte{0, 0, 0, 9, 1})
+	f.Close()
+	b, err = OpenBuffer(WithChannelCapacity(1), WithDiskSpill(dir, 0, BytesCodec{}))
+	if err != nil {
+		t.Fatalf("OpenBuffer failed: %v", err)
+	}
+	defer b.Dispose()
+	for len(received) != 4 {
+		received = append(received, string((<-b.Channel()).([]byte)))
+	}
+	if strings.Join(received, "") != "bcde" {
+		t.Fatalf("received%v is not expected", received)
+	}
+	if b.Push([]byte("f")) == PushDropped {
+		t.Fatal("push after recovering is dropped")
+	}
+	if v := <-b.Channel(); string(v.([]byte)) != "f" {
+		t.Fatalf("element[%s] is not expected", v)
+	}
+	if _, err := OpenBuffer(WithDiskSpill(filepath.Join(dir, spillCheckpoint, "invalid"), 0, BytesCodec{})); err == nil {
+		t.Fatal("OpenBuffer with invalid dir does not fail")
+	}
+}
+
+func TestDiskSpillCapacity(t *testing.T) {
+	b, err := OpenBuffer(WithChannelCapacity(1), WithDiskSpill(t.TempDir(), 1, BytesCodec{}), WithQueueCapacity(2))
+	if err != nil {
+		t.Fatalf("OpenBuffer failed: %v", err)
+	}
+	defer b.Dispose()
+	var dropped int
+	for _, s := range []string{"a", "b", "c", "d", "e"} {
+		if b.Push([]byte(s)) == PushDropped {
+			dropped++
+		}
+	}
+	if dropped == 0 {
+		t.Fatal("elements beyond the capacity are not dropped")
+	}
+	if b.Size() > 3 {
+		t.Fatalf("size[%d] is beyond the capacity", b.Size())
+	}
+	if b.Push(1) != PushDropped {
+		t.Fatal("element could not be encoded is not dropped")
+	}
+}
@@ -0,0 +1,117 @@
+package reactor
+
+import (
+	"context"
+	"reflect"
+)
+
+// Future is the result of a function called by Call, it's completed when the function returns,
+// or the function is canceled as the Reactor is stopped.
+type Future[T any] struct {
+	done  chan struct{}
+	value T
+	err   error
+}
+
+// Call inserts the function to Reactor's queue as Push, and returns the Future of its result.
+// The error of the Future is the error returned by the function, or ErrHandlerCanceled typed ErrTypeHandlerCanceled
+// when the Reactor is stopped before the function run, or ErrInvalidStatus typed ErrTypeInvalidStatus when the Reactor
+// has been stopped.
+func Call[T any](r *Reactor, f func(ctx context.Context) (T, error)) *Future[T] {
+	return call(r, f, priorityNormal)
+}
+
+// CallPriority is the same as Call, but the function is higher priority than Call as PushPriority.
+func CallPriority[T any](r *Reactor, f func(ctx context.Context) (T, error)) *Future[T] {
+	return call(r, f, priorityHigh)
+}
+
+func call[T any](r *Reactor, f func(ctx context.Context) (T, error), priority int) *Future[T] {
+	future := &Future[T]{
+		done: make(chan struct{}),
+	}
+	task := r.newReactorTask(func(ctx context.Context) {
+		defer close(future.done)
+		future.value, future.err = f(ctx)
+	})
+	task.canceled = func(err error) {
+		future.err = err
+		close(future.done)
+	}
+	if err := r.submit(task, priority); err != nil {
+		future.err = err
+		close(future.done)
+	}
+	return future
+}
+
+// Done returns a channel which is closed when the Future is completed.
+func (f *Future[T]) Done() <-chan struct{} {
+	return f.done
+}
+
+// Get waits for the Future completed and returns the result, it returns the error of context when it's done before.
+func (f *Future[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// WaitAll waits for all Futures completed and returns the values in the order of Futures.
+// It returns the error as soon as any Future fails, or the error of context when it's done before.
+func WaitAll[T any](ctx context.Context, futures ...*Future[T]) ([]T, error) {
+	values := make([]T, len(futures))
+	cases, indexes := selectCases(ctx, futures)
+	for len(cases) > 1 {
+		n, _, _ := reflect.Select(cases)
+		if n == 0 {
+			return nil, ctx.Err()
+		}
+		f := futures[indexes[n-1]]
+		if f.err != nil {
+			return nil, f.err
+		}
+		values[indexes[n-1]] = f.value
+		cases = append(cases[:n], cases[n+1:]...)
+		indexes = append(indexes[:n-1], indexes[n:]...)
+	}
+	return values, nil
+}
+
+// WaitAny waits for the first Future completed, and returns its index and result.
+// It returns -1 with the error of context when it's done before, and -1 without error when no Futures given.
+func WaitAny[T any](ctx context.Context, futures ...*Future[T]) (int, T, error) {
+	var zero T
+	if len(futures) == 0 {
+		return -1, zero, nil
+	}
+	cases, _ := selectCases(ctx, futures)
+	n, _, _ := reflect.Select(cases)
+	if n == 0 {
+		return -1, zero, ctx.Err()
+	}
+	f := futures[n-1]
+	return n - 1, f.value, f.err
+}
+
+// selectCases returns the cases for selecting the context and the Futures, and the index of Future of each case except the first.
+func selectCases[T any](ctx context.Context, futures []*Future[T]) ([]reflect.SelectCase, []int) {
+	cases := make([]reflect.SelectCase, 0, len(futures)+1)
+	indexes := make([]int, 0, len(futures))
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(ctx.Done()),
+	})
+	for i, f := range futures {
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(f.done),
+		})
+		indexes = append(indexes, i)
+	}
+	return cases, indexes
+}
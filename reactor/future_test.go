@@ -0,0 +1,98 @@
+package reactor
+
+import (
+	"context"
+	"errors"
+	"github.com/more-infra/base"
+	"github.com/more-infra/base/status"
+	"testing"
+	"time"
+)
+
+func TestCall(t *testing.T) {
+	r := NewReactor()
+	r.Start()
+	errFailed := errors.New("failed")
+	var futures []*Future[int]
+	for i := 0; i != 10; i++ {
+		i := i
+		futures = append(futures, Call(r, func(context.Context) (int, error) {
+			return i * i, nil
+		}))
+	}
+	if v, err := futures[3].Get(context.Background()); err != nil || v != 9 {
+		t.Fatalf("future value[%d] is not expected: %v", v, err)
+	}
+	values, err := WaitAll(context.Background(), futures...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, v := range values {
+		if v != i*i {
+			t.Fatalf("future values%v is not expected", values)
+		}
+	}
+
+	failed := Call(r, func(context.Context) (int, error) {
+		return 0, errFailed
+	})
+	if _, err := WaitAll(context.Background(), futures[0], failed); err != errFailed {
+		t.Fatalf("wait all error[%v] is not expected", err)
+	}
+
+	// the reactor is blocked, so the futures are canceled when it stops
+	released := make(chan struct{})
+	blocked := Call(r, func(context.Context) (string, error) {
+		<-released
+		return "blocked", nil
+	})
+	canceled := Call(r, func(context.Context) (string, error) {
+		return "canceled", nil
+	})
+	c, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := canceled.Get(c); err != context.DeadlineExceeded {
+		t.Fatalf("get error[%v] is not expected", err)
+	}
+	if _, _, err := WaitAny(c, canceled); err != context.DeadlineExceeded {
+		t.Fatalf("wait any error[%v] is not expected", err)
+	}
+	priority := CallPriority(r, func(context.Context) (string, error) {
+		return "priority", nil
+	})
+	go func() {
+		// wait any is waiting before the futures completed
+		time.Sleep(10 * time.Millisecond)
+		close(released)
+	}()
+	n, v, err := WaitAny(context.Background(), canceled, priority, blocked)
+	if err != nil || n != 2 || v != "blocked" {
+		t.Fatalf("wait any result[%d %s] is not expected: %v", n, v, err)
+	}
+	if v, _ := priority.Get(context.Background()); v != "priority" {
+		t.Fatalf("future value[%s] is not expected", v)
+	}
+	<-canceled.Done()
+
+	released = make(chan struct{})
+	Call(r, func(context.Context) (int, error) {
+		<-released
+		return 0, nil
+	})
+	pending := Call(r, func(context.Context) (int, error) {
+		return 0, nil
+	})
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(released)
+	}()
+	r.Stop()
+	if _, err := pending.Get(context.Background()); base.ErrorType(err) != ErrTypeHandlerCanceled {
+		t.Fatalf("get error[%v] of canceled future is not expected", err)
+	}
+	if _, err := Call(r, func(context.Context) (int, error) {
+		return 0, nil
+	}).Get(context.Background()); base.ErrorType(err) != status.ErrTypeInvalidStatus {
+		t.Fatalf("get error[%v] after Stop is not expected", err)
+	}
+}
@@ -0,0 +1,307 @@
+package reactor
+
+import (
+	"context"
+	"github.com/more-infra/base"
+	"github.com/more-infra/base/status"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+const (
+	DefaultVirtualNodes = 128
+)
+
+// Pool is a group of Reactors, the Handlers are routed to the Reactors by the key with consistent hashing.
+// The Handlers with the same key run in order on one Reactor as they are pushed, and the Handlers with different keys
+// run on different Reactors in parallel.
+//
+// The count of Reactors could be changed by Resize, a few keys are moved to other Reactors by consistent hashing,
+// the Handlers of the key moved wait for the Handlers pushed before resizing on the previous Reactor, so the order is kept.
+// As waiting for the previous Reactor, the Handler on the previous Reactor calls Send of the Pool while resizing may cause deadlock.
+//
+// All methods of Pool are thread-safe.
+type Pool struct {
+	poolOptions
+	statusController *status.Controller
+	mu               sync.RWMutex
+	resizing         sync.Mutex
+	reactors         []*Reactor
+	ring             *hashRing
+	migration        *migration
+}
+
+type poolOptions struct {
+	replicas int
+	options  []Option
+}
+
+type PoolOption func(*poolOptions)
+
+// WithVirtualNodes defines the count of virtual nodes of each Reactor on the hash ring,
+// the more nodes make the keys distributed more evenly. The default value is 128.
+func WithVirtualNodes(n int) PoolOption {
+	return func(o *poolOptions) {
+		o.replicas = n
+	}
+}
+
+// WithReactorOption defines the options for creating the Reactors in Pool.
+func WithReactorOption(options ...Option) PoolOption {
+	return func(o *poolOptions) {
+		o.options = append(o.options, options...)
+	}
+}
+
+// migration keeps the hash ring before resizing, and the barriers closed when the Handlers pushed before resizing are run.
+type migration struct {
+	ring     *hashRing
+	reactors []*Reactor
+	barriers []chan struct{}
+}
+
+// NewPool creates the Pool with size Reactors, it panics when the size is less than 1.
+func NewPool(size int, options ...PoolOption) *Pool {
+	if size < 1 {
+		panic("reactor pool size is less than 1")
+	}
+	p := &Pool{
+		poolOptions: poolOptions{
+			replicas: DefaultVirtualNodes,
+		},
+		statusController: status.NewController(),
+	}
+	for _, op := range options {
+		op(&p.poolOptions)
+	}
+	for i := 0; i != size; i++ {
+		p.reactors = append(p.reactors, NewReactor(p.options...))
+	}
+	p.ring = newHashRing(size, p.replicas)
+	return p
+}
+
+// Start is required to call before Push or Send Handler to the Pool, it starts all Reactors.
+// It will be called with Stop in pair.
+func (p *Pool) Start() {
+	if !p.statusController.Starting() {
+		return
+	}
+	defer p.statusController.Started()
+	for _, r := range p.reactors {
+		r.Start()
+	}
+}
+
+// Stop is called for shutdown the Pool, all Reactors are stopped as Reactor.Stop.
+func (p *Pool) Stop() {
+	if !p.statusController.Stopping() {
+		return
+	}
+	defer p.statusController.Stopped()
+	p.mu.RLock()
+	reactors := p.reactors
+	p.mu.RUnlock()
+	for _, r := range reactors {
+		r.Stop()
+	}
+}
+
+// Push inserts the handler to the Reactor of the key and returns immediately, see Reactor.Push.
+func (p *Pool) Push(key string, handler Handler) error {
+	_, err := p.submit(key, handler)
+	return err
+}
+
+// Send inserts the handler to the Reactor of the key and waits for the Handler run completed, see Reactor.Send.
+func (p *Pool) Send(key string, handler Handler) error {
+	task, err := p.submit(key, handler)
+	if err != nil {
+		return err
+	}
+	task.wait()
+	return task.err()
+}
+
+// Resize changes the count of Reactors, and returns after the Handlers pushed before resizing on the Reactors are run,
+// and the Reactors removed are stopped. It panics when the size is less than 1.
+// If the Pool has been stopped, it will return ErrInvalidStatus error with typed ErrTypeInvalidStatus.
+func (p *Pool) Resize(size int) error {
+	if size < 1 {
+		panic("reactor pool size is less than 1")
+	}
+	if !p.statusController.KeepRunning() {
+		return base.NewErrorWithType(status.ErrTypeInvalidStatus, status.ErrInvalidStatus).
+			WithField("size", size)
+	}
+	defer p.statusController.ReleaseRunning()
+	p.resizing.Lock()
+	defer p.resizing.Unlock()
+
+	p.mu.Lock()
+	if size == len(p.reactors) {
+		p.mu.Unlock()
+		return nil
+	}
+	m := &migration{
+		ring:     p.ring,
+		reactors: p.reactors,
+		barriers: make([]chan struct{}, len(p.reactors)),
+	}
+	for i, r := range p.reactors {
+		barrier := make(chan struct{})
+		m.barriers[i] = barrier
+		if r.Push(func(context.Context) {
+			close(barrier)
+		}) != nil {
+			close(barrier)
+		}
+	}
+	keep := size
+	if keep > len(p.reactors) {
+		keep = len(p.reactors)
+	}
+	removed := append([]*Reactor(nil), p.reactors[keep:]...)
+	reactors := append([]*Reactor(nil), p.reactors[:keep]...)
+	for len(reactors) < size {
+		r := NewReactor(p.options...)
+		r.Start()
+		reactors = append(reactors, r)
+	}
+	p.reactors = reactors
+	p.ring = newHashRing(size, p.replicas)
+	p.migration = m
+	p.mu.Unlock()
+
+	for i := range m.barriers {
+		m.wait(i, context.Background())
+	}
+	p.mu.Lock()
+	p.migration = nil
+	p.mu.Unlock()
+	for _, r := range removed {
+		r.Stop()
+	}
+	return nil
+}
+
+// Size returns the count of Reactors.
+func (p *Pool) Size() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return len(p.reactors)
+}
+
+// Waiting returns the count of Handlers which are in the queues of all Reactors and waiting for run.
+func (p *Pool) Waiting() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	var n int
+	for _, r := range p.reactors {
+		n += r.Waiting()
+	}
+	return n
+}
+
+func (p *Pool) submit(key string, handler Handler) (*reactorTask, error) {
+	if !p.statusController.KeepRunning() {
+		return nil, base.NewErrorWithType(status.ErrTypeInvalidStatus, status.ErrInvalidStatus).
+			WithField("key", key).
+			WithStack()
+	}
+	defer p.statusController.ReleaseRunning()
+	// the lock is held until the Handler inserted, so it's before the barriers when resizing
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	hash := hashKey(key)
+	n := p.ring.locate(hash)
+	task := p.reactors[n].newReactorTask(handler)
+	if m := p.migration; m != nil {
+		if prev := m.ring.locate(hash); prev != n {
+			task.handler = func(ctx context.Context) {
+				if !m.wait(prev, ctx) {
+					// the Reactor is stopped while waiting, the Handler is canceled as it's not run
+					task.errCancel = base.NewErrorWithType(ErrTypeHandlerCanceled, ErrHandlerCanceled).
+						WithField("key", key)
+					return
+				}
+				handler(ctx)
+			}
+		}
+	}
+	if err := p.reactors[n].submit(task, priorityNormal); err != nil {
+		return nil, err
+	}
+	return task, nil
+}
+
+// wait waits for the Handlers pushed before resizing on the n-th previous Reactor are run or canceled,
+// it returns false when the context is done.
+func (m *migration) wait(n int, ctx context.Context) bool {
+	select {
+	case <-m.barriers[n]:
+	case <-m.reactors[n].c.Done():
+	case <-ctx.Done():
+		return false
+	}
+	return true
+}
+
+// hashRing is the consistent hashing ring of Reactors, each Reactor has replicas virtual nodes on it.
+type hashRing struct {
+	hashes []uint32
+	nodes  []int
+}
+
+func newHashRing(size int, replicas int) *hashRing {
+	if replicas < 1 {
+		replicas = 1
+	}
+	type point struct {
+		hash uint32
+		node int
+	}
+	points := make([]point, 0, size*replicas)
+	for n := 0; n != size; n++ {
+		for v := 0; v != replicas; v++ {
+			points = append(points, point{
+				hash: hashKey(strconv.Itoa(n) + "#" + strconv.Itoa(v)),
+				node: n,
+			})
+		}
+	}
+	sort.Slice(points, func(i, j int) bool {
+		if points[i].hash != points[j].hash {
+			return points[i].hash < points[j].hash
+		}
+		return points[i].node < points[j].node
+	})
+	ring := &hashRing{
+		hashes: make([]uint32, len(points)),
+		nodes:  make([]int, len(points)),
+	}
+	for i, pt := range points {
+		ring.hashes[i] = pt.hash
+		ring.nodes[i] = pt.node
+	}
+	return ring
+}
+
+// locate returns the Reactor of the hash, which is the first virtual node not before it on the ring.
+func (r *hashRing) locate(hash uint32) int {
+	i := sort.Search(len(r.hashes), func(i int) bool {
+		return r.hashes[i] >= hash
+	})
+	if i == len(r.hashes) {
+		i = 0
+	}
+	return r.nodes[i]
+}
+
+func hashKey(key string) uint32 {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return h.Sum32()
+}
@@ -0,0 +1,190 @@
+package reactor
+
+import (
+	"context"
+	"github.com/more-infra/base"
+	"github.com/more-infra/base/status"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool(4)
+	p.Start()
+	defer p.Stop()
+	const (
+		keys = 50
+		num  = 100
+	)
+	var (
+		mu     sync.Mutex
+		result = make(map[string][]int)
+		wg     sync.WaitGroup
+	)
+	push := func(i int) {
+		for k := 0; k != keys; k++ {
+			key := strconv.Itoa(k)
+			wg.Add(1)
+			err := p.Push(key, func(context.Context) {
+				defer wg.Done()
+				mu.Lock()
+				result[key] = append(result[key], i)
+				mu.Unlock()
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	for i := 0; i != num; i++ {
+		push(i)
+		switch i {
+		case 30:
+			go p.Resize(7)
+		case 60:
+			go p.Resize(2)
+		}
+	}
+	wg.Wait()
+	for k := 0; k != keys; k++ {
+		vv := result[strconv.Itoa(k)]
+		if len(vv) != num {
+			t.Fatalf("key[%d] handlers count[%d] is not expected", k, len(vv))
+		}
+		for i, v := range vv {
+			if v != i {
+				t.Fatalf("key[%d] handlers order%v is not expected", k, vv)
+			}
+		}
+	}
+}
+
+func TestPoolResize(t *testing.T) {
+	p := NewPool(2)
+	p.Start()
+	// a slow handler on the previous Reactors, the handlers of keys moved wait for it
+	released := make(chan struct{})
+	for k := 0; k != 20; k++ {
+		p.Push(strconv.Itoa(k), func(context.Context) {
+			<-released
+		})
+	}
+	done := make(chan struct{})
+	go func() {
+		p.Resize(5)
+		close(done)
+	}()
+	waitSize := func(n int) {
+		for p.Size() != n {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	waitSize(5)
+	var (
+		mu  sync.Mutex
+		ran []string
+	)
+	for k := 0; k != 20; k++ {
+		key := strconv.Itoa(k)
+		p.Push(key, func(context.Context) {
+			mu.Lock()
+			ran = append(ran, key)
+			mu.Unlock()
+		})
+	}
+	time.Sleep(20 * time.Millisecond)
+	mu.Lock()
+	if len(ran) != 0 {
+		t.Fatalf("handlers%v run before the handlers pushed before resizing", ran)
+	}
+	mu.Unlock()
+	select {
+	case <-done:
+		t.Fatal("resize returns before the previous handlers run")
+	default:
+	}
+	close(released)
+	<-done
+	if err := p.Send("0", func(context.Context) {}); err != nil {
+		t.Fatal(err)
+	}
+	p.Stop()
+	if err := p.Push("0", func(context.Context) {}); base.ErrorType(err) != status.ErrTypeInvalidStatus {
+		t.Fatalf("push error[%v] after Stop is not expected", err)
+	}
+	if err := p.Resize(3); base.ErrorType(err) != status.ErrTypeInvalidStatus {
+		t.Fatalf("resize error[%v] after Stop is not expected", err)
+	}
+}
+
+func TestHashRing(t *testing.T) {
+	const keys = 10000
+	prev, ring := newHashRing(4, DefaultVirtualNodes), newHashRing(5, DefaultVirtualNodes)
+	counts := make([]int, 5)
+	var moved int
+	for k := 0; k != keys; k++ {
+		hash := hashKey(strconv.Itoa(k))
+		n := ring.locate(hash)
+		counts[n]++
+		if m := prev.locate(hash); m != n {
+			if n != 4 {
+				t.Fatalf("key[%d] is moved between the previous reactors", k)
+			}
+			moved++
+		}
+	}
+	// about 1/5 keys are moved to the new one
+	if moved < keys/10 || moved > keys*3/10 {
+		t.Fatalf("moved keys count[%d] is not expected", moved)
+	}
+	for n, c := range counts {
+		if c < keys/10 || c > keys*3/10 {
+			t.Fatalf("reactor[%d] keys count[%d] is not expected", n, c)
+		}
+	}
+}
+
+func TestPoolResizeCanceled(t *testing.T) {
+	p := NewPool(1)
+	p.Start()
+	released := make(chan struct{})
+	p.Push("0", func(context.Context) {
+		<-released
+	})
+	resized := make(chan struct{})
+	go func() {
+		p.Resize(2)
+		close(resized)
+	}()
+	for p.Size() != 2 {
+		time.Sleep(time.Millisecond)
+	}
+	// the key moved to the new Reactor waits for the previous one
+	var key string
+	for k := 0; key == ""; k++ {
+		if p.ring.locate(hashKey(strconv.Itoa(k))) == 1 {
+			key = strconv.Itoa(k)
+		}
+	}
+	sent := make(chan error)
+	var ran bool
+	go func() {
+		sent <- p.Send(key, func(context.Context) {
+			ran = true
+		})
+	}()
+	// the handler is waiting in the new Reactor
+	time.Sleep(20 * time.Millisecond)
+	p.mu.RLock()
+	r := p.reactors[1]
+	p.mu.RUnlock()
+	r.Stop()
+	if err := <-sent; base.ErrorType(err) != ErrTypeHandlerCanceled || ran {
+		t.Fatalf("send error[%v] of the handler not run is not expected", err)
+	}
+	close(released)
+	<-resized
+	p.Stop()
+}
@@ -28,16 +28,19 @@ type Reactor struct {
 	statusController *status.Controller
 	c                context.Context
 	cancel           context.CancelFunc
-	queue            *queue.Buffer
-	priority         *queue.Buffer
+	queue            *queue.PriorityBuffer[*reactorTask]
 }
 
+const (
+	priorityNormal = iota
+	priorityHigh
+)
+
 func NewReactor(options ...Option) *Reactor {
 	r := &Reactor{
 		runner:           runner.NewRunner(),
 		statusController: status.NewController(),
-		queue:            queue.NewBuffer(),
-		priority:         queue.NewBuffer(),
+		queue:            queue.NewPriorityBufferOf[*reactorTask](2),
 	}
 	for _, op := range options {
 		op(r)
@@ -82,13 +85,7 @@ func (r *Reactor) Stop() {
 	defer r.statusController.Stopped()
 	r.cancel()
 	r.runner.CloseWait()
-	for _, v := range r.priority.Dispose() {
-		task := v.(*reactorTask)
-		task.cancel(base.NewErrorWithType(ErrTypeHandlerCanceled, ErrHandlerCanceled).
-			WithFields(task.KV()))
-	}
-	for _, v := range r.queue.Dispose() {
-		task := v.(*reactorTask)
+	for _, task := range r.queue.Dispose() {
 		task.cancel(base.NewErrorWithType(ErrTypeHandlerCanceled, ErrHandlerCanceled).
 			WithFields(task.KV()))
 	}
@@ -99,26 +96,12 @@ type Handler func(context.Context)
 // Push will insert the handler to Reactor's queue and return immediately.
 // If the Reactor has benn stopped, it will return ErrInvalidStatus error with typed ErrTypeInvalidStatus.
 func (r *Reactor) Push(handler Handler) error {
-	if !r.statusController.KeepRunning() {
-		return base.NewErrorWithType(status.ErrTypeInvalidStatus, status.ErrInvalidStatus).
-			WithField("handler", handler).
-			WithStack()
-	}
-	defer r.statusController.ReleaseRunning()
-	r.queue.Push(r.newReactorTask(handler))
-	return nil
+	return r.submit(r.newReactorTask(handler), priorityNormal)
 }
 
 // PushPriority is the same as Push, but the Handler is higher priority than Push.
 func (r *Reactor) PushPriority(handler Handler) error {
-	if !r.statusController.KeepRunning() {
-		return base.NewErrorWithType(status.ErrTypeInvalidStatus, status.ErrInvalidStatus).
-			WithField("handler", handler).
-			WithStack()
-	}
-	defer r.statusController.ReleaseRunning()
-	r.priority.Push(r.newReactorTask(handler))
-	return nil
+	return r.submit(r.newReactorTask(handler), priorityHigh)
 }
 
 // Send will insert the handler to Reactor's queue and wait for the Handler run completed.
@@ -126,41 +109,39 @@ func (r *Reactor) PushPriority(handler Handler) error {
 // If the Handler inserted to the queue and waiting for run, but the Reactor is Stop,
 // it will return ErrHandlerCanceled error with ErrTypeHandlerCanceled.
 func (r *Reactor) Send(handler Handler) error {
-	if !r.statusController.KeepRunning() {
-		return base.NewErrorWithType(status.ErrTypeInvalidStatus, status.ErrInvalidStatus).
-			WithField("handler", handler).
-			WithStack()
-	}
 	task := r.newReactorTask(handler)
-	r.queue.Push(task)
-	r.statusController.ReleaseRunning()
-	task.wait()
-	if err := task.err(); err != nil {
+	if err := r.submit(task, priorityNormal); err != nil {
 		return err
 	}
-	return nil
+	task.wait()
+	return task.err()
 }
 
 // SendPriority is the same as Send, but the Handler is higher priority than Send.
 func (r *Reactor) SendPriority(handler Handler) error {
+	task := r.newReactorTask(handler)
+	if err := r.submit(task, priorityHigh); err != nil {
+		return err
+	}
+	task.wait()
+	return task.err()
+}
+
+// submit inserts the task to the queue with the priority.
+func (r *Reactor) submit(task *reactorTask, priority int) error {
 	if !r.statusController.KeepRunning() {
 		return base.NewErrorWithType(status.ErrTypeInvalidStatus, status.ErrInvalidStatus).
-			WithField("handler", handler).
+			WithField("handler", task.handler).
 			WithStack()
 	}
-	task := r.newReactorTask(handler)
-	r.priority.Push(task)
-	r.statusController.ReleaseRunning()
-	task.wait()
-	if err := task.err(); err != nil {
-		return err
-	}
+	defer r.statusController.ReleaseRunning()
+	r.queue.Push(task, priority)
 	return nil
 }
 
 // Waiting return the count of Handlers which are in the queue and waiting for run.
 func (r *Reactor) Waiting() int {
-	return r.queue.Size() + r.priority.Size()
+	return r.queue.Size()
 }
 
 func (r *Reactor) newReactorTask(handler Handler) *reactorTask {
@@ -173,10 +154,6 @@ func (r *Reactor) newReactorTask(handler Handler) *reactorTask {
 }
 
 func (r *Reactor) running() {
-	var (
-		chQueue         = r.queue.Channel()
-		chPriorityQueue = r.priority.Channel()
-	)
 	defer r.runner.Done()
 	for {
 		select {
@@ -185,22 +162,8 @@ func (r *Reactor) running() {
 		case <-r.c.Done():
 			go r.Stop()
 			return
-		case v := <-chPriorityQueue:
-			task := v.(*reactorTask)
+		case task := <-r.queue.Channel():
 			task.run()
-			if len(chPriorityQueue) != 0 {
-				chQueue = nil
-			} else {
-				chQueue = r.queue.Channel()
-			}
-		case v := <-chQueue:
-			task := v.(*reactorTask)
-			task.run()
-			if len(chPriorityQueue) != 0 {
-				chQueue = nil
-			} else {
-				chQueue = r.queue.Channel()
-			}
 		}
 	}
 }
@@ -210,6 +173,7 @@ type reactorTask struct {
 	ctx       context.Context
 	wg        sync.WaitGroup
 	errCancel error
+	canceled  func(err error)
 }
 
 func (t *reactorTask) run() {
@@ -223,6 +187,9 @@ func (t *reactorTask) wait() {
 
 func (t *reactorTask) cancel(err error) {
 	t.errCancel = err
+	if t.canceled != nil {
+		t.canceled(err)
+	}
 	t.wg.Done()
 }
 
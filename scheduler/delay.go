@@ -18,7 +18,7 @@ type delayManager struct {
 func newDelayManager() *delayManager {
 	return &delayManager{
 		Runner:  runner.NewRunner(),
-		items:   element.NewManager(),
+		items:   element.NewManager(element.WithCopyOnWrite()),
 		refresh: make(chan struct{}, 1),
 	}
 }
@@ -57,11 +57,11 @@ func (dm *delayManager) running() {
 	}()
 	for {
 		pool.Reset()
-		snapShot := dm.items.Snapshot()
-		for _, e := range snapShot {
+		dm.items.View().Range(func(e element.ELEMENT) bool {
 			item := e.(*delayItem)
 			pool.Push(item, item.expired())
-		}
+			return true
+		})
 		e, flag := pool.Select()
 		if flag == chanpool.SelectQuitReturned {
 			return
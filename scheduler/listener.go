@@ -17,7 +17,7 @@ type listenerManager struct {
 func newListenerManager() *listenerManager {
 	return &listenerManager{
 		Runner:    runner.NewRunner(),
-		listeners: element.NewManager(),
+		listeners: element.NewManager(element.WithCopyOnWrite()),
 		refresh:   make(chan struct{}, 1),
 	}
 }
@@ -56,11 +56,11 @@ func (lm *listenerManager) running() {
 	}()
 	for {
 		pool.Reset()
-		snapShot := lm.listeners.Snapshot()
-		for _, e := range snapShot {
+		lm.listeners.View().Range(func(e element.ELEMENT) bool {
 			l := e.(*listener)
 			pool.Push(l, l.done())
-		}
+			return true
+		})
 		e, flag := pool.Select()
 		if flag == chanpool.SelectQuitReturned {
 			return
@@ -15,7 +15,7 @@ type workerManager struct {
 	option   workerManagerOption
 	c        context.Context
 	cancel   context.CancelFunc
-	queue    *queue.Buffer
+	queue    *queue.Buffer[*Entity]
 	taskChan chan func()
 	workers  *element.Manager
 	once     sync.Once
@@ -51,7 +51,7 @@ func newWorkerManager(optionFuncs ...workerManagerOptionFunc) *workerManager {
 		c:        c,
 		cancel:   cancel,
 		taskChan: make(chan func()),
-		queue:    queue.NewBuffer(),
+		queue:    queue.NewBufferOf[*Entity](),
 		workers:  element.NewManager(),
 	}
 	for _, f := range optionFuncs {
@@ -97,8 +97,7 @@ func (wm *workerManager) running() {
 		select {
 		case <-wm.runner.Quit():
 			return
-		case v := <-wm.queue.Channel():
-			entity := v.(*Entity)
+		case entity := <-wm.queue.Channel():
 			var overload bool
 			select {
 			case <-wm.runner.Quit():
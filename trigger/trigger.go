@@ -20,7 +20,7 @@ type Trigger struct {
 	conf             config
 	addCh            chan interface{}
 	flush            chan struct{}
-	receiver         *queue.Buffer
+	receiver         *queue.AnyBuffer
 }
 
 type Option func(*Trigger)
@@ -29,8 +29,10 @@ type Option func(*Trigger)
 // Elements in receiver queue is type '[]interface{}'.
 // Option provides trigger setting, such as max_time, max_count or condition defined by yourself.
 // One option would be setting at least, all options could be set together yet.
+// The receiver could use queue.PolicyBlock for backpressure, packing is paused while the receiver is full,
+// and Add and Flush wait until the receiver is consumed. The receiver must be consumed until the empty batch is received when Stop.
 // All methods of Trigger are thread-safe.
-func NewTrigger(receiver *queue.Buffer, ops ...Option) *Trigger {
+func NewTrigger(receiver *queue.AnyBuffer, ops ...Option) *Trigger {
 	c := &Trigger{
 		statusController: status.NewController(),
 		runner:           runner.NewRunner(),